@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shivanshkc/rosenbridge-cli/lib"
+
+	"github.com/spf13/viper"
+)
+
+// Supported values of the auth.type config.
+const (
+	authTypeBearer = "bearer"
+	authTypeAPIKey = "api_key"
+	authTypeBasic  = "basic"
+	authTypeHelper = "helper"
+)
+
+// defaultAPIKeyHeader is the header in which the API key is sent, unless the auth.api_key_header config is set.
+const defaultAPIKeyHeader = "X-API-Key"
+
+// credentialHelperTimeout is the maximum duration of a credential helper run.
+const credentialHelperTimeout = 30 * time.Second
+
+// credentialHelperExpiryLeeway is the time before the expiry of a token at which it is refreshed.
+const credentialHelperExpiryLeeway = 30 * time.Second
+
+// credentialHelperOutput is the JSON that a credential helper can print, instead of a plain token, to tell the expiry.
+type credentialHelperOutput struct {
+	// Token is the token.
+	Token string `json:"token"`
+	// ExpiresAt is the RFC3339 time at which the token expires.
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// credentialHelper is a lib.TokenSource that gets the tokens by running the user's command.
+type credentialHelper struct {
+	// command is the command line of the helper.
+	command string
+
+	// token is the last token provided by the helper. It is only reused if its expiry is known.
+	token string
+	// expiresAt is the expiry of the token.
+	expiresAt time.Time
+	// mutex serializes the helper runs and guards the token fields.
+	mutex *sync.Mutex
+}
+
+// getAuthenticator provides the authenticator as per the auth configs. It is nil if no credentials are configured.
+//
+// The type of the auth is taken from the auth.type config. If that is not set, it is inferred from the other configs.
+// The CLI exits if the configs are incomplete. The credentials themselves are never printed.
+func getAuthenticator() lib.Authenticator {
+	authType := viper.GetString("auth.type")
+	if authType == "" {
+		authType = inferAuthType()
+	}
+
+	switch authType {
+	case "", "none":
+		return nil
+	case authTypeBearer:
+		return lib.BearerTokenAuth(requireAuthConfig("auth.token", authType))
+	case authTypeAPIKey:
+		header := viper.GetString("auth.api_key_header")
+		if header == "" {
+			header = defaultAPIKeyHeader
+		}
+		return lib.APIKeyAuth(header, requireAuthConfig("auth.api_key", authType))
+	case authTypeBasic:
+		// An empty password is valid.
+		return lib.BasicAuth(requireAuthConfig("auth.username", authType), viper.GetString("auth.password"))
+	case authTypeHelper:
+		return lib.TokenSourceAuth(&credentialHelper{command: requireAuthConfig("auth.helper", authType), mutex: &sync.Mutex{}})
+	default:
+		exitWithPrintf(exitCodeFailure, "Unknown auth.type config %q, use one of: %s, %s, %s, %s, none", authType,
+			authTypeBearer, authTypeAPIKey, authTypeBasic, authTypeHelper)
+		return nil
+	}
+}
+
+// inferAuthType provides the type of the auth as per the configs that are set.
+func inferAuthType() string {
+	switch {
+	case viper.GetString("auth.helper") != "":
+		return authTypeHelper
+	case viper.GetString("auth.token") != "":
+		return authTypeBearer
+	case viper.GetString("auth.api_key") != "":
+		return authTypeAPIKey
+	case viper.GetString("auth.username") != "":
+		return authTypeBasic
+	default:
+		return ""
+	}
+}
+
+// requireAuthConfig provides the value of the given config, required by the given auth type.
+// The CLI exits if it is empty.
+func requireAuthConfig(key string, authType string) string {
+	value := viper.GetString(key)
+	if value == "" {
+		exitWithPrintf(exitCodeFailure, "The %s config (or the %s env var) is required for the %s auth.", key,
+			getConfigEnvVar(key), authType)
+	}
+	return value
+}
+
+// Token runs the helper command and provides the token it prints, unless the last token is still valid.
+//
+// The helper can print the token alone, or a JSON object with the "token" and "expires_at" fields. Tokens without a
+// known expiry are never reused, so the helper runs upon every request and (re)connection. The stderr of the helper
+// goes to the stderr of the CLI, but its stdout is never printed, since it holds the token.
+func (c *credentialHelper) Token(ctx context.Context) (string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.token != "" && time.Now().Add(credentialHelperExpiryLeeway).Before(c.expiresAt) {
+		return c.token, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, credentialHelperTimeout)
+	defer cancel()
+
+	stdout := &bytes.Buffer{}
+	command := shellCommand(ctx, c.command)
+	command.Stdout, command.Stderr = stdout, os.Stderr
+	if err := command.Run(); err != nil {
+		return "", fmt.Errorf("credential helper failed: %w", err)
+	}
+
+	output := strings.TrimSpace(stdout.String())
+	token, expiresAt := output, time.Time{}
+	if strings.HasPrefix(output, "{") {
+		decoded := &credentialHelperOutput{}
+		// The error is not wrapped, as it may quote the output.
+		if err := json.Unmarshal([]byte(output), decoded); err != nil {
+			return "", errors.New("credential helper printed invalid json")
+		}
+		token, expiresAt = decoded.Token, decoded.ExpiresAt
+	}
+
+	if token == "" {
+		return "", errors.New("credential helper printed no token")
+	}
+
+	c.token, c.expiresAt = token, expiresAt
+	return token, nil
+}
@@ -0,0 +1,342 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shivanshkc/rosenbridge-cli/lib"
+
+	"github.com/fatih/color"
+	"github.com/google/uuid"
+)
+
+// Supported batch file formats.
+const (
+	batchFormatJSONL = "jsonl"
+	batchFormatCSV   = "csv"
+)
+
+// Statuses of the batch results.
+const (
+	batchStatusDelivered = "delivered"
+	batchStatusPartial   = "partial"
+	batchStatusFailed    = "failed"
+	batchStatusError     = "error"
+)
+
+// errNoBatchReceivers is reported for the batch items that have no receivers, and no default ones are provided.
+var errNoBatchReceivers = errors.New("no receivers, set the receiver_ids of the item or use the --receivers flag")
+
+// batchItem is a single message of the batch file.
+type batchItem struct {
+	// Line is the line number of the item in the batch file.
+	Line int `json:"-"`
+	// ReceiverIDs are the IDs of the clients that are intended to receive the message.
+	ReceiverIDs []string `json:"receiver_ids"`
+	// Message is the message body.
+	Message string `json:"message"`
+	// RequestID is the optional ID of the request. It is generated if not provided.
+	RequestID string `json:"request_id"`
+
+	// err is set if the item could not be parsed.
+	err error
+}
+
+// batchResult is the outcome of sending a single item of the batch file.
+type batchResult struct {
+	// Line is the line number of the item in the batch file.
+	Line int `json:"line"`
+	// RequestID is the ID of the request with which the message was sent.
+	RequestID string `json:"request_id,omitempty"`
+	// ReceiverIDs are the IDs of the clients that were intended to receive the message.
+	ReceiverIDs []string `json:"receiver_ids,omitempty"`
+	// Status is the overall status of the item.
+	Status string `json:"status"`
+	// Report is the delivery report of the message.
+	Report map[string][]*lib.DeliveryReport `json:"report,omitempty"`
+	// Error describes why the item could not be sent.
+	Error string `json:"error,omitempty"`
+}
+
+// batchSender sends all messages of a batch file.
+type batchSender struct {
+	// params are used for sending the messages.
+	params *lib.ConnectionParams
+	// parallelism is the number of messages that are sent at the same time.
+	parallelism int
+	// rate is the maximum number of messages sent per second. Zero means no limit.
+	rate float64
+	// results receives the result of every item as a JSON line.
+	results io.Writer
+
+	// counts holds the number of results of each status.
+	counts map[string]int
+	// resultsMutex guards the results and counts fields.
+	resultsMutex *sync.Mutex
+}
+
+// run sends all the given items and writes their results. It returns when all items are processed.
+func (b *batchSender) run(items <-chan *batchItem) {
+	// The limiter lets one message through at every tick.
+	var limiter <-chan time.Time
+	if b.rate > 0 {
+		// Very high rates would round the interval down to zero, which the ticker does not accept.
+		interval := time.Duration(float64(time.Second) / b.rate)
+		if interval < 1 {
+			interval = 1
+		}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		limiter = ticker.C
+	}
+
+	waitGroup := &sync.WaitGroup{}
+	for i := 0; i < b.parallelism; i++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			for item := range items {
+				// Parsing errors are reported without being rate limited.
+				if item.err != nil {
+					b.record(&batchResult{Line: item.Line, Status: batchStatusError, Error: item.err.Error()})
+					continue
+				}
+				if limiter != nil {
+					<-limiter
+				}
+				b.record(b.send(item))
+			}
+		}()
+	}
+
+	waitGroup.Wait()
+}
+
+// send sends the given item and provides its result.
+func (b *batchSender) send(item *batchItem) *batchResult {
+	result := &batchResult{Line: item.Line, RequestID: item.RequestID, ReceiverIDs: item.ReceiverIDs}
+	if result.RequestID == "" {
+		result.RequestID = uuid.NewString()
+	}
+
+	// Rosenbridge would reject the message anyway, so it is not sent at all.
+	if len(item.ReceiverIDs) == 0 {
+		result.Status, result.Error = batchStatusError, errNoBatchReceivers.Error()
+		return result
+	}
+	if err := checkClientIDSlice(item.ReceiverIDs); err != nil {
+		result.Status, result.Error = batchStatusError, err.Error()
+		return result
+	}
+
+	// Every item gets its own copy of the params, since they are used concurrently.
+	params := *b.params
+	response, err := lib.SendMessage(context.Background(), &lib.OutgoingMessageReq{
+		RequestID:   result.RequestID,
+		ReceiverIDs: item.ReceiverIDs,
+		Message:     item.Message,
+	}, &params)
+	if err != nil {
+		result.Status, result.Error = batchStatusError, err.Error()
+		return result
+	}
+
+	result.Report = response.Report
+	switch {
+	case !response.Failed():
+		result.Status = batchStatusDelivered
+	case len(response.DeliveredReceivers()) == 0:
+		result.Status = batchStatusFailed
+	default:
+		result.Status = batchStatusPartial
+	}
+	return result
+}
+
+// record writes the given result and updates the counts.
+func (b *batchSender) record(result *batchResult) {
+	b.resultsMutex.Lock()
+	defer b.resultsMutex.Unlock()
+
+	b.counts[result.Status]++
+	if result.Status == batchStatusError {
+		color.Red(">> Line %d: %s\n", result.Line, result.Error)
+	}
+
+	line, err := json.Marshal(result)
+	if err != nil {
+		color.Red("Failed to marshal result of line %d: %s\n", result.Line, err.Error())
+		return
+	}
+	if _, err := b.results.Write(append(line, '\n')); err != nil {
+		color.Red("Failed to write result of line %d: %s\n", result.Line, err.Error())
+	}
+}
+
+// exitCode provides the exit code as per the results of the batch.
+func (b *batchSender) exitCode() int {
+	b.resultsMutex.Lock()
+	defer b.resultsMutex.Unlock()
+
+	delivered := b.counts[batchStatusDelivered]
+	switch {
+	case b.counts[batchStatusError] > 0:
+		return exitCodeFailure
+	case b.counts[batchStatusPartial] == 0 && b.counts[batchStatusFailed] == 0:
+		return exitCodeOK
+	case delivered == 0 && b.counts[batchStatusPartial] == 0:
+		return exitCodeDeliveryFailed
+	default:
+		return exitCodePartialDelivery
+	}
+}
+
+// summary provides a human-readable summary of the batch results.
+func (b *batchSender) summary() string {
+	b.resultsMutex.Lock()
+	defer b.resultsMutex.Unlock()
+
+	total := 0
+	for _, count := range b.counts {
+		total += count
+	}
+
+	return fmt.Sprintf("Processed %d messages: %d delivered, %d partially delivered, %d failed, %d errors.",
+		total, b.counts[batchStatusDelivered], b.counts[batchStatusPartial], b.counts[batchStatusFailed],
+		b.counts[batchStatusError])
+}
+
+// readBatchFile streams the items of the given batch file into the returned channel.
+//
+// The format is detected from the file extension if not provided. Items without receivers get the default ones.
+func readBatchFile(path string, format string, defaultReceiverIDs []string) (<-chan *batchItem, error) {
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+		if format == "ndjson" || format == "json" {
+			format = batchFormatJSONL
+		}
+	}
+	if format != batchFormatJSONL && format != batchFormatCSV {
+		return nil, fmt.Errorf("unknown batch file format %q, use one of: %s, %s", format, batchFormatJSONL,
+			batchFormatCSV)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open batch file: %w", err)
+	}
+
+	items := make(chan *batchItem)
+	go func() {
+		defer close(items)
+		defer func() { _ = file.Close() }()
+
+		readItems := readJSONLItems
+		if format == batchFormatCSV {
+			readItems = readCSVItems
+		}
+
+		readItems(file, func(item *batchItem) {
+			if item.err == nil && len(item.ReceiverIDs) == 0 {
+				item.ReceiverIDs = defaultReceiverIDs
+			}
+			items <- item
+		})
+	}()
+
+	return items, nil
+}
+
+// readJSONLItems reads the batch items from the given JSONL content and passes them to the given func.
+// Empty lines are skipped.
+func readJSONLItems(reader io.Reader, yield func(item *batchItem)) {
+	scanner := bufio.NewScanner(reader)
+	// Allowing long messages.
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), 16*1024*1024) //nolint:gomnd // 16 MiB lines.
+
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		item := &batchItem{}
+		if err := json.Unmarshal(scanner.Bytes(), item); err != nil {
+			item.err = fmt.Errorf("failed to decode line: %w", err)
+		}
+		item.Line = line
+		yield(item)
+	}
+
+	if err := scanner.Err(); err != nil {
+		yield(&batchItem{err: fmt.Errorf("failed to read batch file: %w", err)})
+	}
+}
+
+// readCSVItems reads the batch items from the given CSV content and passes them to the given func.
+//
+// The first row must be a header with the receiver_ids, message and (optionally) request_id columns. The receiver IDs
+// within a cell are comma-separated, and the spaces around them are ignored.
+func readCSVItems(reader io.Reader, yield func(item *batchItem)) {
+	csvReader := csv.NewReader(reader)
+	csvReader.FieldsPerRecord = -1
+
+	header, err := csvReader.Read()
+	if err != nil {
+		yield(&batchItem{Line: 1, err: fmt.Errorf("failed to read csv header: %w", err)})
+		return
+	}
+
+	// Mapping the column names to their indices.
+	columns := map[string]int{}
+	for index, name := range header {
+		columns[strings.TrimSpace(strings.ToLower(name))] = index
+	}
+	if _, exists := columns["message"]; !exists {
+		yield(&batchItem{Line: 1, err: errors.New("csv header must have a message column")})
+		return
+	}
+
+	// cell provides the value of the given column in the given row, or an empty string if absent.
+	cell := func(row []string, column string) string {
+		if index, exists := columns[column]; exists && index < len(row) {
+			return row[index]
+		}
+		return ""
+	}
+
+	for line := 2; ; line++ {
+		row, err := csvReader.Read()
+		if errors.Is(err, io.EOF) {
+			return
+		}
+		// A malformed row is skipped, but any other error means that the rest of the file cannot be read.
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			yield(&batchItem{Line: line, err: fmt.Errorf("failed to read csv row: %w", err)})
+			continue
+		}
+		if err != nil {
+			yield(&batchItem{Line: line, err: fmt.Errorf("failed to read batch file: %w", err)})
+			return
+		}
+
+		item := &batchItem{Line: line, Message: cell(row, "message"), RequestID: cell(row, "request_id")}
+		if receiverIDs := strings.TrimSpace(cell(row, "receiver_ids")); receiverIDs != "" {
+			for _, receiverID := range strings.Split(receiverIDs, ",") {
+				item.ReceiverIDs = append(item.ReceiverIDs, strings.TrimSpace(receiverID))
+			}
+		}
+		yield(item)
+	}
+}
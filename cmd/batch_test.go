@@ -0,0 +1,237 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/shivanshkc/rosenbridge-cli/lib/rosentest"
+)
+
+// errReader fails every read with its error.
+type errReader struct {
+	err error
+}
+
+// Read implements io.Reader.
+func (e *errReader) Read([]byte) (int, error) {
+	return 0, e.err
+}
+
+func TestReadJSONLItems(t *testing.T) {
+	input := `{"receiver_ids": ["bob", "carol"], "message": "hello", "request_id": "r1"}
+
+{"message": "no receivers"}
+{not json
+`
+	items := collectItems(strings.NewReader(input), readJSONLItems)
+
+	expected := []*batchItem{
+		{Line: 1, ReceiverIDs: []string{"bob", "carol"}, Message: "hello", RequestID: "r1"},
+		{Line: 3, Message: "no receivers"},
+		{Line: 4},
+	}
+	assertItems(t, items, expected, []bool{false, false, true})
+}
+
+func TestReadJSONLItems_ReadError(t *testing.T) {
+	items := collectItems(&errReader{err: errors.New("disk failure")}, readJSONLItems)
+	if len(items) != 1 || items[0].err == nil || !strings.Contains(items[0].err.Error(), "disk failure") {
+		t.Fatalf("expected a single read error, got: %+v", items)
+	}
+}
+
+func TestReadCSVItems(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected []*batchItem
+		failed   []bool
+	}{
+		{
+			name: "receivers with spaces",
+			input: "receiver_ids,message,request_id\n\"bob, carol\",hello,r1\n,no receivers,\n" +
+				"\" dave \",\"multi, part\",\n",
+			expected: []*batchItem{
+				{Line: 2, ReceiverIDs: []string{"bob", "carol"}, Message: "hello", RequestID: "r1"},
+				{Line: 3, Message: "no receivers"},
+				{Line: 4, ReceiverIDs: []string{"dave"}, Message: "multi, part"},
+			},
+			failed: []bool{false, false, false},
+		},
+		{
+			name:  "header in any order and case",
+			input: " Message ,RECEIVER_IDS\nhello,bob\n",
+			expected: []*batchItem{
+				{Line: 2, ReceiverIDs: []string{"bob"}, Message: "hello"},
+			},
+			failed: []bool{false},
+		},
+		{
+			name:     "malformed row is skipped",
+			input:    "receiver_ids,message\nbob,\"unterminated\" quote\ncarol,hello\n",
+			expected: []*batchItem{{Line: 2}, {Line: 3, ReceiverIDs: []string{"carol"}, Message: "hello"}},
+			failed:   []bool{true, false},
+		},
+		{
+			name:     "no message column",
+			input:    "receiver_ids,body\nbob,hello\n",
+			expected: []*batchItem{{Line: 1}},
+			failed:   []bool{true},
+		},
+		{
+			name:     "empty file",
+			input:    "",
+			expected: []*batchItem{{Line: 1}},
+			failed:   []bool{true},
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			items := collectItems(strings.NewReader(testCase.input), readCSVItems)
+			assertItems(t, items, testCase.expected, testCase.failed)
+		})
+	}
+}
+
+func TestReadCSVItems_ReadError(t *testing.T) {
+	// The error repeats forever, so it must stop the reading.
+	reader := io.MultiReader(strings.NewReader("receiver_ids,message\nbob,hello\n"),
+		&errReader{err: errors.New("disk failure")})
+	items := collectItems(reader, readCSVItems)
+
+	if len(items) != 2 || items[0].err != nil || items[1].err == nil {
+		t.Fatalf("expected an item and a read error, got: %+v", items)
+	}
+	if !strings.Contains(items[1].err.Error(), "disk failure") {
+		t.Fatalf("expected the read error, got: %v", items[1].err)
+	}
+}
+
+func TestBatchSender_ExitCode(t *testing.T) {
+	testCases := []struct {
+		name     string
+		counts   map[string]int
+		expected int
+	}{
+		{name: "empty", counts: map[string]int{}, expected: exitCodeOK},
+		{name: "all delivered", counts: map[string]int{batchStatusDelivered: 3}, expected: exitCodeOK},
+		{
+			name:     "some partial",
+			counts:   map[string]int{batchStatusDelivered: 3, batchStatusPartial: 1},
+			expected: exitCodePartialDelivery,
+		},
+		{
+			name:     "some failed",
+			counts:   map[string]int{batchStatusDelivered: 3, batchStatusFailed: 1},
+			expected: exitCodePartialDelivery,
+		},
+		{
+			name:     "partial and failed",
+			counts:   map[string]int{batchStatusPartial: 1, batchStatusFailed: 1},
+			expected: exitCodePartialDelivery,
+		},
+		{name: "all failed", counts: map[string]int{batchStatusFailed: 3}, expected: exitCodeDeliveryFailed},
+		{
+			name:     "any error",
+			counts:   map[string]int{batchStatusDelivered: 3, batchStatusError: 1},
+			expected: exitCodeFailure,
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			sender := &batchSender{counts: testCase.counts, resultsMutex: &sync.Mutex{}}
+			if code := sender.exitCode(); code != testCase.expected {
+				t.Fatalf("expected exit code %d, got %d", testCase.expected, code)
+			}
+		})
+	}
+}
+
+func TestBatchSender_Run(t *testing.T) {
+	server := rosentest.NewServer()
+	defer server.Close()
+
+	connectClient(t, server, "bob")
+
+	items := make(chan *batchItem, 4) //nolint:gomnd // All items of the test.
+	items <- &batchItem{Line: 1, ReceiverIDs: []string{"bob"}, Message: "hello"}
+	items <- &batchItem{Line: 2, ReceiverIDs: []string{"bob", "carol"}, Message: "hello"}
+	items <- &batchItem{Line: 3, Message: "no receivers"}
+	items <- &batchItem{Line: 4, err: errors.New("failed to decode line")}
+	close(items)
+
+	// A rate this high must not break the limiter.
+	results := &bytes.Buffer{}
+	sender := &batchSender{
+		params:       server.ConnectionParams("alice"),
+		parallelism:  1,
+		rate:         1e12,
+		results:      results,
+		counts:       map[string]int{},
+		resultsMutex: &sync.Mutex{},
+	}
+	sender.run(items)
+
+	statuses := map[int]string{}
+	errorMessages := map[int]string{}
+	decoder := json.NewDecoder(results)
+	for decoder.More() {
+		result := &batchResult{}
+		if err := decoder.Decode(result); err != nil {
+			t.Fatalf("failed to decode result: %v", err)
+		}
+		statuses[result.Line], errorMessages[result.Line] = result.Status, result.Error
+	}
+
+	expected := map[int]string{1: batchStatusDelivered, 2: batchStatusPartial, 3: batchStatusError, 4: batchStatusError}
+	if !reflect.DeepEqual(statuses, expected) {
+		t.Fatalf("expected statuses %v, got %v", expected, statuses)
+	}
+	if errorMessages[3] != errNoBatchReceivers.Error() {
+		t.Fatalf("expected the missing receivers to be reported, got: %s", errorMessages[3])
+	}
+	if routed := server.RoutedMessages(); len(routed) != 2 {
+		t.Fatalf("expected 2 routed messages, got %d", len(routed))
+	}
+}
+
+// collectItems reads all items using the given func.
+func collectItems(reader io.Reader, readItems func(io.Reader, func(*batchItem))) []*batchItem {
+	var items []*batchItem
+	readItems(reader, func(item *batchItem) { items = append(items, item) })
+	return items
+}
+
+// assertItems fails the test if the given items do not match the expected ones. Only the line numbers of the failed
+// items are compared.
+func assertItems(t *testing.T, items, expected []*batchItem, failed []bool) {
+	t.Helper()
+
+	if len(items) != len(expected) {
+		t.Fatalf("expected %d items, got %d: %+v", len(expected), len(items), items)
+	}
+	for i, item := range items {
+		if (item.err != nil) != failed[i] {
+			t.Fatalf("item %d: expected failure to be %t, got error: %v", i, failed[i], item.err)
+		}
+		if failed[i] {
+			if item.Line != expected[i].Line {
+				t.Fatalf("item %d: expected line %d, got %d", i, expected[i].Line, item.Line)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(item, expected[i]) {
+			t.Fatalf("item %d: expected %+v, got %+v", i, expected[i], item)
+		}
+	}
+}
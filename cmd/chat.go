@@ -0,0 +1,482 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shivanshkc/rosenbridge-cli/lib"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/google/uuid"
+	"github.com/rivo/tview"
+)
+
+// chatAllPartners is the sidebar entry that shows the conversations with all partners.
+const chatAllPartners = "All"
+
+// chatMaxEntries is the maximum number of entries kept in the chat history. Older ones are discarded.
+const chatMaxEntries = 1000
+
+// chatUpdatesBufferSize is the number of UI updates that can wait to be run.
+const chatUpdatesBufferSize = 256
+
+// chatQuitCommand exits the chat when written in the input line.
+const chatQuitCommand = "/quit"
+
+// Delivery statuses of the outgoing chat messages.
+const (
+	chatStatusSending chatStatus = iota
+	chatStatusDelivered
+	chatStatusPartial
+	chatStatusFailed
+)
+
+// chatStatus is the delivery status of an outgoing chat message.
+type chatStatus int
+
+// chatEntry is a single line of the chat history.
+type chatEntry struct {
+	// time at which the entry was created.
+	time time.Time
+	// outgoing tells if the message was sent by the user.
+	outgoing bool
+	// system tells if the entry is a notice of the CLI itself, rather than a message.
+	system bool
+	// senderID is the ID of the client who sent the message.
+	senderID string
+	// partners are the IDs of the other clients in this message, that is, the sender of an incoming message, or the
+	// receivers of an outgoing one.
+	partners []string
+	// message is the message content.
+	message string
+	// requestID is the ID of the request with which the message was sent.
+	requestID string
+	// verification tells if an incoming message is proven to come from its sender.
+	verification lib.Verification
+	// status is the delivery status of an outgoing message.
+	status chatStatus
+	// detail describes the delivery status, like the receivers that were offline.
+	detail string
+}
+
+// chatUI is the full-screen terminal UI of the chat command.
+//
+// All its state is only accessed by the tview event goroutine, so the connection handlers must go through queue.
+type chatUI struct {
+	// conn is the connection used for both sending and receiving messages.
+	conn *lib.Connection
+	// clientID is the ID of the user.
+	clientID string
+	// receiverIDs are the partners that receive the messages written while "All" is selected.
+	receiverIDs []string
+
+	// app is the tview application.
+	app *tview.Application
+	// history is the scrolling pane of the messages.
+	history *tview.TextView
+	// sidebar lists the conversation partners.
+	sidebar *tview.List
+	// input is the line where the messages are written.
+	input *tview.InputField
+
+	// entries is the chat history, in chronological order.
+	entries []*chatEntry
+	// entriesByRequestID maps the pending outgoing messages to their entries, to update them upon responses.
+	entriesByRequestID map[string]*chatEntry
+	// partners are the IDs of all conversation partners, in the order of their appearance.
+	partners []string
+	// unread holds the number of unread messages of every partner.
+	unread map[string]int
+	// selected is the sidebar entry that is currently selected.
+	selected string
+
+	// updates holds the funcs waiting to be run on the event goroutine.
+	updates chan func()
+	// doneChan is closed once the UI is stopped, after which the updates are discarded.
+	doneChan chan struct{}
+}
+
+// newChatUI creates the chat UI for the given client and its default receivers.
+// The connection must be set before the UI is run.
+func newChatUI(clientID string, receiverIDs []string) *chatUI {
+	ui := &chatUI{
+		clientID:           clientID,
+		receiverIDs:        receiverIDs,
+		app:                tview.NewApplication(),
+		history:            tview.NewTextView(),
+		sidebar:            tview.NewList(),
+		input:              tview.NewInputField(),
+		entriesByRequestID: map[string]*chatEntry{},
+		unread:             map[string]int{},
+		selected:           chatAllPartners,
+		updates:            make(chan func(), chatUpdatesBufferSize),
+		doneChan:           make(chan struct{}),
+	}
+
+	ui.history.SetDynamicColors(true).SetScrollable(true).SetWrap(true).
+		SetChangedFunc(func() { ui.history.ScrollToEnd() })
+	ui.history.SetBorder(true)
+
+	ui.sidebar.ShowSecondaryText(false).SetHighlightFullLine(true).
+		SetChangedFunc(func(index int, _, _ string, _ rune) { ui.selectPartner(index) })
+	ui.sidebar.SetBorder(true).SetTitle(" Partners ")
+
+	ui.input.SetLabel(">> You: ").SetFieldBackgroundColor(tcell.ColorDefault).
+		SetDoneFunc(func(key tcell.Key) {
+			if key == tcell.KeyEnter {
+				ui.submit()
+			}
+		})
+
+	// Tab switches the focus between the input line and the sidebar.
+	ui.app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() != tcell.KeyTab {
+			return event
+		}
+		if ui.input.HasFocus() {
+			ui.app.SetFocus(ui.sidebar)
+		} else {
+			ui.app.SetFocus(ui.input)
+		}
+		return nil
+	})
+
+	for _, receiverID := range receiverIDs {
+		ui.addPartner(receiverID)
+	}
+	ui.renderSidebar()
+	ui.renderHistory()
+
+	main := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(ui.history, 0, 1, false).
+		AddItem(ui.input, 1, 0, true)
+	root := tview.NewFlex().
+		AddItem(ui.sidebar, 24, 0, false). //nolint:gomnd // Width of the sidebar.
+		AddItem(main, 0, 1, true)
+
+	ui.app.SetRoot(root, true).SetFocus(ui.input)
+	return ui
+}
+
+// run blocks until the UI is stopped, either by the user or by stop.
+func (u *chatUI) run() error {
+	defer close(u.doneChan)
+
+	// Pumping the queued updates into the application, one at a time to keep their order.
+	go func() {
+		for {
+			select {
+			case update := <-u.updates:
+				u.app.QueueUpdateDraw(update)
+			case <-u.doneChan:
+				return
+			}
+		}
+	}()
+
+	if err := u.app.Run(); err != nil {
+		return fmt.Errorf("failed to run chat ui: %w", err)
+	}
+	return nil
+}
+
+// stop stops the UI.
+func (u *chatUI) stop() {
+	u.app.Stop()
+}
+
+// queue runs the given func on the event goroutine of the UI and redraws it. It is a no-op once the UI is stopped.
+//
+// The application's own QueueUpdateDraw blocks until the func is run, which would block the connection forever after
+// the UI is stopped. So, the funcs go through the updates channel instead.
+func (u *chatUI) queue(update func()) {
+	select {
+	case u.updates <- update:
+	case <-u.doneChan:
+	}
+}
+
+// handleIncomingMessage is the lib.IncomingMessageHandlerFunc of the chat.
+func (u *chatUI) handleIncomingMessage(ctx context.Context, message *lib.IncomingMessageReq, err error) {
+	u.queue(func() {
+		if err != nil {
+			u.addSystemEntry(fmt.Sprintf("Error while reading the message: %s", err.Error()))
+			return
+		}
+		if message == nil {
+			u.addSystemEntry("Message is of unrecognized format.")
+			return
+		}
+
+		text, _ := getMessageText(message)
+
+		u.addPartner(message.SenderID)
+		if u.selected != chatAllPartners && u.selected != message.SenderID {
+			u.unread[message.SenderID]++
+		}
+
+		u.addEntry(&chatEntry{
+			time:         time.Now(),
+			senderID:     message.SenderID,
+			partners:     []string{message.SenderID},
+			message:      text,
+			requestID:    message.RequestID,
+			verification: message.Verification,
+		})
+		u.renderSidebar()
+	})
+}
+
+// handleResponse is the lib.OutgoingMessageResponseHandlerFunc of the chat.
+// It updates the delivery status of the corresponding outgoing message.
+func (u *chatUI) handleResponse(ctx context.Context, response *lib.OutgoingMessageRes, err error) {
+	u.queue(func() {
+		if err != nil {
+			u.addSystemEntry(fmt.Sprintf("Error while reading the delivery report: %s", err.Error()))
+			return
+		}
+
+		entry, exists := u.entriesByRequestID[response.RequestID]
+		if !exists {
+			return
+		}
+		delete(u.entriesByRequestID, response.RequestID)
+
+		switch {
+		case response.Code != string(lib.CodeOK):
+			entry.status, entry.detail = chatStatusFailed, response.Reason
+		case !response.Failed():
+			entry.status = chatStatusDelivered
+		case len(response.DeliveredReceivers()) == 0:
+			entry.status, entry.detail = chatStatusFailed, describeChatFailures(response)
+		default:
+			entry.status, entry.detail = chatStatusPartial, describeChatFailures(response)
+		}
+		u.renderHistory()
+	})
+}
+
+// handleConnectionEvent is the lib.ConnectionEventHandlerFunc of the chat.
+func (u *chatUI) handleConnectionEvent(ctx context.Context, event *lib.ConnectionEvent) {
+	u.queue(func() {
+		switch event.Type {
+		case lib.EventReconnecting:
+			u.addSystemEntry(fmt.Sprintf("Connection lost (%v). Reconnecting in %s, attempt %d...",
+				event.Err, event.Delay.Round(time.Millisecond), event.Attempt))
+		case lib.EventReconnected:
+			u.addSystemEntry("Reconnected with Rosenbridge.")
+		default:
+		}
+	})
+}
+
+// submit sends the message written in the input line to the selected partners.
+func (u *chatUI) submit() {
+	message := u.input.GetText()
+	u.input.SetText("")
+
+	switch strings.TrimSpace(message) {
+	case "":
+		return
+	case chatQuitCommand:
+		u.stop()
+		return
+	}
+
+	receiverIDs := u.receiverIDs
+	if u.selected != chatAllPartners {
+		receiverIDs = []string{u.selected}
+	}
+	if len(receiverIDs) == 0 {
+		u.addSystemEntry("Select a partner in the sidebar to send the message to.")
+		return
+	}
+
+	entry := &chatEntry{
+		time:      time.Now(),
+		outgoing:  true,
+		senderID:  u.clientID,
+		partners:  receiverIDs,
+		message:   message,
+		requestID: uuid.NewString(),
+	}
+	u.entriesByRequestID[entry.requestID] = entry
+	u.addEntry(entry)
+
+	request := &lib.OutgoingMessageReq{
+		SenderID:    u.clientID,
+		ReceiverIDs: receiverIDs,
+		Message:     message,
+		RequestID:   entry.requestID,
+	}
+
+	// The write may block for a while, so it is kept off the event goroutine.
+	go func() {
+		if err := u.conn.SendMessageAsync(context.Background(), request); err != nil {
+			u.queue(func() {
+				delete(u.entriesByRequestID, entry.requestID)
+				entry.status, entry.detail = chatStatusFailed, err.Error()
+				u.renderHistory()
+			})
+		}
+	}()
+}
+
+// selectPartner is called when the sidebar selection changes to the given index.
+func (u *chatUI) selectPartner(index int) {
+	u.selected = chatAllPartners
+	if index > 0 && index <= len(u.partners) {
+		u.selected = u.partners[index-1]
+	}
+
+	delete(u.unread, u.selected)
+	u.renderSidebar()
+	u.renderHistory()
+}
+
+// addPartner adds the given client to the sidebar, if it isn't already there.
+func (u *chatUI) addPartner(partnerID string) {
+	for _, existing := range u.partners {
+		if existing == partnerID {
+			return
+		}
+	}
+	u.partners = append(u.partners, partnerID)
+}
+
+// addSystemEntry adds a notice of the CLI to the history.
+func (u *chatUI) addSystemEntry(message string) {
+	u.addEntry(&chatEntry{time: time.Now(), system: true, message: message})
+}
+
+// addEntry adds the given entry to the history, discarding the oldest entries beyond the limit.
+func (u *chatUI) addEntry(entry *chatEntry) {
+	u.entries = append(u.entries, entry)
+	if len(u.entries) > chatMaxEntries {
+		for _, discarded := range u.entries[:len(u.entries)-chatMaxEntries] {
+			delete(u.entriesByRequestID, discarded.requestID)
+		}
+		u.entries = u.entries[len(u.entries)-chatMaxEntries:]
+	}
+	u.renderHistory()
+}
+
+// renderSidebar redraws the sidebar as per the partners and their unread counts.
+func (u *chatUI) renderSidebar() {
+	// The changed func must not fire while the list is rebuilt.
+	changedFunc := func(index int, _, _ string, _ rune) { u.selectPartner(index) }
+	u.sidebar.SetChangedFunc(nil)
+	defer u.sidebar.SetChangedFunc(changedFunc)
+
+	u.sidebar.Clear()
+	u.sidebar.AddItem(chatAllPartners, "", 0, nil)
+
+	current := 0
+	for index, partnerID := range u.partners {
+		label := tview.Escape(partnerID)
+		if count := u.unread[partnerID]; count > 0 {
+			label = fmt.Sprintf("%s [yellow](%d)[-]", label, count)
+		}
+		u.sidebar.AddItem(label, "", 0, nil)
+
+		if partnerID == u.selected {
+			current = index + 1
+		}
+	}
+	u.sidebar.SetCurrentItem(current)
+}
+
+// renderHistory redraws the history pane, showing only the entries of the selected partner.
+func (u *chatUI) renderHistory() {
+	title := " Chat "
+	if u.selected != chatAllPartners {
+		title = fmt.Sprintf(" Chat with %s ", u.selected)
+	}
+	u.history.SetTitle(title)
+
+	builder := &strings.Builder{}
+	for _, entry := range u.entries {
+		if !entry.system && u.selected != chatAllPartners && !containsString(entry.partners, u.selected) {
+			continue
+		}
+		builder.WriteString(formatChatEntry(entry))
+		builder.WriteString("\n")
+	}
+
+	u.history.SetText(builder.String())
+}
+
+// formatChatEntry provides the history line of the given entry, with tview color tags.
+func formatChatEntry(entry *chatEntry) string {
+	timestamp := fmt.Sprintf("[gray]%s[-]", entry.time.Format(time.Kitchen))
+
+	switch {
+	case entry.system:
+		return fmt.Sprintf("%s [red]%s[-]", timestamp, tview.Escape(entry.message))
+	case !entry.outgoing:
+		return fmt.Sprintf("%s [yellow]%s[-]%s: %s", timestamp, tview.Escape(entry.senderID),
+			formatVerification(entry.verification), tview.Escape(entry.message))
+	}
+
+	line := fmt.Sprintf("%s [green]You[-] → %s: %s %s", timestamp, tview.Escape(strings.Join(entry.partners, ",")),
+		tview.Escape(entry.message), formatChatStatus(entry.status))
+	if entry.detail != "" {
+		line += fmt.Sprintf(" [gray](%s)[-]", tview.Escape(entry.detail))
+	}
+	return line
+}
+
+// formatChatStatus provides the delivery tick of the given status, with tview color tags.
+func formatChatStatus(status chatStatus) string {
+	switch status {
+	case chatStatusDelivered:
+		return "[green]✓[-]"
+	case chatStatusPartial:
+		return "[yellow]✓[-]"
+	case chatStatusFailed:
+		return "[red]✗[-]"
+	default:
+		return "[gray]…[-]"
+	}
+}
+
+// describeChatFailures provides a short description of the receivers that did not receive the message.
+func describeChatFailures(response *lib.OutgoingMessageRes) string {
+	failures := response.FailedReceivers()
+	sort.Strings(failures)
+
+	descriptions := make([]string, 0, len(failures))
+	for _, receiverID := range failures {
+		descriptions = append(descriptions, fmt.Sprintf("%s: %s", receiverID,
+			describeDeliveryStatus(response.ReceiverStatus(receiverID))))
+	}
+	return strings.Join(descriptions, ", ")
+}
+
+// containsString tells if the given slice contains the given string.
+func containsString(slice []string, value string) bool {
+	for _, element := range slice {
+		if element == value {
+			return true
+		}
+	}
+	return false
+}
+
+// formatVerification provides the marker of the given verification result for the history, with tview color tags.
+// Unverified messages are not marked, since that is the norm for the senders that do not sign.
+func formatVerification(verification lib.Verification) string {
+	switch verification {
+	case lib.VerificationVerified:
+		return " [green](verified)[-]"
+	case lib.VerificationForged:
+		return " [red](FORGED)[-]"
+	case lib.VerificationUnverified:
+		fallthrough
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/shivanshkc/rosenbridge-cli/lib"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// These variables bind with the flags of the chat command.
+var chatClientID, chatReceiverIDs string
+
+// chatCmd represents the chat command.
+var chatCmd = &cobra.Command{
+	Use:   "chat",
+	Short: "Opens a full-screen chat with the intended clients.",
+	Long: `Opens a full-screen chat that shows the incoming and outgoing messages in one pane, along with their delivery
+status. The sidebar lists the conversation partners. Selecting one of them (Tab to focus, arrow keys to move) shows only
+its conversation, and sends the new messages only to it. Type /quit or press Ctrl+C to exit.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		// Validating the inputs.
+		chatClientID = resolveClientID(chatClientID, "client-id")
+		if err := checkClientID(chatClientID); err != nil {
+			exitWithPrintf(exitCodeFailure, err.Error())
+		}
+
+		// Receivers are optional, as the partners who send messages are added to the sidebar anyway.
+		var receiverIDs []string
+		if chatReceiverIDs != "" {
+			receiverIDs = strings.Split(chatReceiverIDs, ",")
+			if err := checkClientIDSlice(receiverIDs); err != nil {
+				exitWithPrintf(exitCodeFailure, err.Error())
+			}
+		}
+
+		// The connection is gracefully closed upon SIGINT or SIGTERM. Ctrl+C itself is captured by the UI.
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer cancel()
+
+		// Creating connection params as per the configs.
+		params := &lib.ConnectionParams{
+			ClientID:     chatClientID,
+			Endpoint:     getEndpoint(),
+			BaseURL:      viper.GetString("backend.base_url"),
+			IsTLSEnabled: viper.GetBool("backend.is_tls_enabled"),
+			Auth:         getAuthenticator(),
+			TLSConfig:    getTLSConfig(),
+			Proxy:        getProxy(),
+			DialTimeout:  viper.GetDuration("backend.dial_timeout"),
+			PingInterval: viper.GetDuration("backend.ping_interval"),
+			PongTimeout:  viper.GetDuration("backend.pong_timeout"),
+			Reconnect:    getReconnectParams(),
+			// Encrypted incoming messages are decrypted with the key pair of the client, if there is one.
+			Encryption: getEncryptionParams(chatClientID, false),
+			// Incoming messages are verified against the trusted keys.
+			Signing: getSigningParams(chatClientID, false, false),
+		}
+
+		ui := newChatUI(chatClientID, receiverIDs)
+
+		// A single connection is used for both directions.
+		conn, err := lib.NewConnection(ctx, params,
+			lib.WithIncomingMessageHandler(ui.handleIncomingMessage),
+			lib.WithOutgoingMessageResponseHandler(ui.handleResponse),
+			lib.WithConnectionEventHandler(ui.handleConnectionEvent),
+			// Closure is reported below, once the UI is stopped.
+			lib.WithConnectionClosureHandler(func(ctx context.Context, err interface{}) {}),
+		)
+		if err != nil {
+			exitWithPrintf(exitCodeFailure, "Failed to connect: %s", err.Error())
+		}
+		ui.conn = conn
+
+		// The UI is stopped if the connection closes on its own.
+		go func() {
+			<-conn.Done()
+			ui.stop()
+		}()
+
+		// Blocking until the user exits, or the connection is closed.
+		if err := ui.run(); err != nil {
+			_ = conn.Close()
+			exitWithPrintf(exitCodeFailure, err.Error())
+		}
+
+		_ = conn.Close()
+		<-conn.Done()
+
+		// Exiting with the appropriate code.
+		if err := conn.Err(); err != nil && !errors.Is(err, context.Canceled) {
+			exitWithPrintf(exitCodeConnectionLost, "Connection closed with error: %s", err.Error())
+		}
+		exitWithPrintf(exitCodeOK, "Disconnected from Rosenbridge.")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(chatCmd)
+
+	// Setting up the --client-id or -c flag.
+	chatCmd.Flags().StringVarP(&chatClientID, "client-id", "c", "",
+		"ID of the client chatting. Defaults to the client_id config.")
+
+	// Setting up the --receivers or -r flag.
+	chatCmd.Flags().StringVarP(&chatReceiverIDs, "receivers", "r", "",
+		"Comma-separated list of client IDs to chat with. Others are added to the sidebar when they send a message.")
+}
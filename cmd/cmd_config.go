@@ -0,0 +1,211 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// configShowSecrets binds with the --show-secrets flag of the config view and get commands.
+var configShowSecrets bool
+
+// configInitForce binds with the --force flag of the config init command.
+var configInitForce bool
+
+// configCmd represents the config command.
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manages the configuration of the CLI.",
+	Long:  ``,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		// Setting a config within a profile that does not exist yet creates that profile.
+		if cmd != configSetCmd {
+			cobra.CheckErr(profileErr)
+		}
+	},
+}
+
+// configViewCmd represents the config view command.
+var configViewCmd = &cobra.Command{
+	Use:   "view",
+	Short: "Shows the effective value of every config, along with its source.",
+	Long: `Shows the effective value of every config, after merging the defaults, the config file, the profile in use
+and the ROSEN_ env vars. The source of every value is shown as well. Secrets are masked unless --show-secrets is given.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		writer := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0) //nolint:gomnd // Padding of the columns.
+		for _, value := range getConfigValues() {
+			_, _ = fmt.Fprintf(writer, "%s\t%s\t(%s)\n", value.Key,
+				formatConfigValue(value.Key, value.Value, configShowSecrets), value.Source)
+		}
+		_ = writer.Flush()
+	},
+}
+
+// configGetCmd represents the config get command.
+var configGetCmd = &cobra.Command{
+	Use:   "get <key>",
+	Short: "Prints the effective value of a config. Its source is printed to stderr.",
+	Long:  ``,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if !viper.IsSet(args[0]) {
+			exitWithPrintf(exitCodeFailure, "config %q is not set", args[0])
+		}
+
+		value := getConfigValue(args[0], readConfigFileOnly())
+		_, _ = fmt.Fprintln(cmd.OutOrStdout(), formatConfigValue(value.Key, value.Value, configShowSecrets))
+		_, _ = fmt.Fprintf(os.Stderr, "Source: %s\n", value.Source)
+	},
+}
+
+// configSetCmd represents the config set command.
+var configSetCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Sets a config in the config file. With --profile, it is set within that profile.",
+	Long:  ``,
+	Args:  cobra.ExactArgs(2), //nolint:gomnd // Key and value.
+	Run: func(cmd *cobra.Command, args []string) {
+		key := getConfigTargetKey(args[0])
+
+		if err := updateConfigFile(func(root *yaml.Node) error {
+			return setConfigNode(root, key, args[1])
+		}); err != nil {
+			exitWithPrintf(exitCodeFailure, err.Error())
+		}
+
+		exitWithPrintf(exitCodeOK, "Set %s.", key)
+	},
+}
+
+// configUnsetCmd represents the config unset command.
+var configUnsetCmd = &cobra.Command{
+	Use:   "unset <key>",
+	Short: "Removes a config from the config file. With --profile, it is removed from that profile.",
+	Long:  ``,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		key := getConfigTargetKey(args[0])
+
+		if err := updateConfigFile(func(root *yaml.Node) error {
+			if !unsetConfigNode(root, key) {
+				return fmt.Errorf("config %q is not set in the config file", key)
+			}
+			return nil
+		}); err != nil {
+			exitWithPrintf(exitCodeFailure, err.Error())
+		}
+
+		exitWithPrintf(exitCodeOK, "Unset %s.", key)
+	},
+}
+
+// configInitCmd represents the config init command.
+var configInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Creates the config file with the default configs.",
+	Long:  ``,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		path, err := getConfigFilePath()
+		if err != nil {
+			exitWithPrintf(exitCodeFailure, err.Error())
+		}
+
+		// An existing file is only replaced upon --force.
+		if _, err := os.Stat(path); err == nil && !configInitForce {
+			exitWithPrintf(exitCodeFailure, "Config file %s already exists. Use --force to overwrite it.", path)
+		} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+			exitWithPrintf(exitCodeFailure, "Failed to check config file: %s", err.Error())
+		}
+
+		if err := writeFileAtomically(path, []byte(defaultConfigFileContent)); err != nil {
+			exitWithPrintf(exitCodeFailure, err.Error())
+		}
+
+		exitWithPrintf(exitCodeOK, "Created config file %s.", path)
+	},
+}
+
+// configPathCmd represents the config path command.
+var configPathCmd = &cobra.Command{
+	Use:   "path",
+	Short: "Prints the path of the config file.",
+	Long:  ``,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		path, err := getConfigFilePath()
+		if err != nil {
+			exitWithPrintf(exitCodeFailure, err.Error())
+		}
+
+		_, _ = fmt.Fprintln(cmd.OutOrStdout(), path)
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			_, _ = fmt.Fprintln(os.Stderr, "The file does not exist yet. Use \"rosen config init\" to create it.")
+		}
+	},
+}
+
+// configUseContextCmd represents the config use-context command.
+var configUseContextCmd = &cobra.Command{
+	Use:   "use-context <profile>",
+	Short: "Sets the profile that is used by default.",
+	Long:  ``,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := args[0]
+
+		err := updateConfigFile(func(root *yaml.Node) error {
+			if lookupConfigNode(root, profilesKey+"."+name) == nil {
+				return fmt.Errorf("profile %q does not exist in the config file", name)
+			}
+			return setConfigNode(root, currentProfileKey, name)
+		})
+		if err != nil {
+			exitWithPrintf(exitCodeFailure, err.Error())
+		}
+
+		exitWithPrintf(exitCodeOK, "Switched to profile %q.", name)
+	},
+}
+
+// configGetContextsCmd represents the config get-contexts command.
+var configGetContextsCmd = &cobra.Command{
+	Use:   "get-contexts",
+	Short: "Lists all profiles. The one in use is marked with an asterisk.",
+	Long:  ``,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		for _, name := range getProfileNames() {
+			marker := " "
+			if name == activeProfile {
+				marker = "*"
+			}
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "%s %s\n", marker, name)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configViewCmd)
+	configCmd.AddCommand(configGetCmd)
+	configCmd.AddCommand(configSetCmd)
+	configCmd.AddCommand(configUnsetCmd)
+	configCmd.AddCommand(configInitCmd)
+	configCmd.AddCommand(configPathCmd)
+	configCmd.AddCommand(configUseContextCmd)
+	configCmd.AddCommand(configGetContextsCmd)
+
+	// Setting up the --show-secrets flag.
+	configViewCmd.Flags().BoolVar(&configShowSecrets, "show-secrets", false, "Show the secrets instead of masking them.")
+	configGetCmd.Flags().BoolVar(&configShowSecrets, "show-secrets", false, "Show the secret instead of masking it.")
+
+	// Setting up the --force flag.
+	configInitCmd.Flags().BoolVar(&configInitForce, "force", false, "Overwrite the config file if it already exists.")
+}
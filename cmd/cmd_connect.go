@@ -2,7 +2,11 @@ package cmd
 
 import (
 	"context"
-	"fmt"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/shivanshkc/rosenbridge-cli/lib"
 
@@ -14,32 +18,136 @@ import (
 // connectClientID binds with the client ID flag of the connect command.
 var connectClientID string
 
+// connectDropUnverified binds with the --drop-unverified flag of the connect command.
+var connectDropUnverified bool
+
+// These variables bind with the --exec flags of the connect command.
+var (
+	connectExecCommand     string
+	connectExecConcurrency int
+	connectExecTimeout     time.Duration
+	connectExecOnFailure   string
+	connectExecReply       bool
+)
+
+// These variables bind with the --forward flags of the connect command.
+var (
+	connectForwardURL        string
+	connectForwardHeaders    []string
+	connectForwardSecret     string
+	connectForwardDeadLetter string
+	connectForwardTimeout    time.Duration
+)
+
 // connectCmd represents the connect command.
 var connectCmd = &cobra.Command{
 	Use:   "connect",
 	Short: "Establishes connection with Rosenbridge and starts streaming messages.",
 	Long:  ``,
 	Run: func(cmd *cobra.Command, args []string) {
+		if err := setupOutput(); err != nil {
+			exitWithPrintf(exitCodeFailure, err.Error())
+		}
+
 		// Validating the client ID.
+		connectClientID = resolveClientID(connectClientID, "client-id")
 		if err := checkClientID(connectClientID); err != nil {
-			exitWithPrintf(1, err.Error())
+			exitWithPrintf(exitCodeFailure, err.Error())
 		}
 
-		// Getting a new connection to Rosenbridge.
-		conn, err := lib.NewConnection(context.Background(), &lib.ConnectionParams{
+		// The connection is gracefully closed upon SIGINT or SIGTERM.
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer cancel()
+
+		// Creating connection params as per the configs.
+		params := &lib.ConnectionParams{
 			ClientID:     connectClientID,
+			Endpoint:     getEndpoint(),
 			BaseURL:      viper.GetString("backend.base_url"),
 			IsTLSEnabled: viper.GetBool("backend.is_tls_enabled"),
-		})
+			Auth:         getAuthenticator(),
+			TLSConfig:    getTLSConfig(),
+			Proxy:        getProxy(),
+			DialTimeout:  viper.GetDuration("backend.dial_timeout"),
+			PingInterval: viper.GetDuration("backend.ping_interval"),
+			PongTimeout:  viper.GetDuration("backend.pong_timeout"),
+			Reconnect:    getReconnectParams(),
+			// Encrypted incoming messages are decrypted with the key pair of the client, if there is one.
+			Encryption: getEncryptionParams(connectClientID, false),
+			// Incoming messages are verified against the trusted keys.
+			Signing: getSigningParams(connectClientID, false, connectDropUnverified),
+		}
+
+		// The exec flags are checked before connecting, as the messages channel is sized by them.
+		if connectExecCommand != "" {
+			if err := checkExecFlags(connectExecConcurrency, connectExecOnFailure); err != nil {
+				exitWithPrintf(exitCodeFailure, err.Error())
+			}
+		}
+
+		// The webhook is checked before connecting, so that a bad flag does not cost a connection.
+		var forwarder *webhookForwarder
+		if connectForwardURL != "" {
+			var err error
+			forwarder, err = newWebhookForwarder(connectForwardURL, connectForwardHeaders, getForwardSecret(),
+				connectForwardDeadLetter, connectForwardTimeout)
+			if err != nil {
+				exitWithPrintf(exitCodeFailure, err.Error())
+			}
+		}
+
+		opts := []lib.ConnectionOption{
+			// Printing all incoming messages.
+			lib.WithIncomingMessageHandler(printMessage),
+			// Keeping the user informed about reconnections.
+			lib.WithConnectionEventHandler(printConnectionEvent),
+			// Closure is reported below, once the connection is done.
+			lib.WithConnectionClosureHandler(func(ctx context.Context, err interface{}) {}),
+		}
+
+		// The messages are also consumed through the channel if a command is to be executed for them, or if they are
+		// to be forwarded. This keeps the slow commands and webhooks off the goroutine that reads the connection.
+		if connectExecCommand != "" || forwarder != nil {
+			bufferSize := forwardBufferSize
+			if connectExecCommand != "" {
+				bufferSize = connectExecConcurrency
+			}
+			opts = append(opts, lib.WithMessagesChannel(bufferSize, lib.OverflowBlock))
+		}
+
+		// Getting a new connection to Rosenbridge.
+		conn, err := lib.NewConnection(ctx, params, opts...)
 		if err != nil {
-			exitWithPrintf(1, "Failed to connect: %s", err.Error())
+			exitWithPrintf(exitCodeFailure, "Failed to connect: %s", err.Error())
 		}
 		color.Green("Connected with Rosenbridge.\n")
 
-		// Printing all incoming messages.
-		conn.IncomingMessageHandler = printMessage
-		// Blocking forever. TODO: Replace this with an interruption listener.
-		select {}
+		var executor *messageExecutor
+		if connectExecCommand != "" {
+			executor, err = newMessageExecutor(conn, connectExecCommand, connectExecConcurrency,
+				connectExecTimeout, connectExecOnFailure, connectExecReply)
+			if err != nil {
+				_ = conn.Close()
+				exitWithPrintf(exitCodeFailure, err.Error())
+			}
+		}
+
+		if executor != nil || forwarder != nil {
+			// This returns after the connection is closed, and all executions and forwards are complete.
+			consumeMessages(conn, executor, forwarder)
+			if executor != nil && executor.hasFailed() && connectExecOnFailure == execOnFailureExit {
+				exitWithPrintf(exitCodeExecFailed, "Disconnected from Rosenbridge due to a command failure.")
+			}
+		}
+
+		// Blocking until the connection is closed, either by an interruption or a failure.
+		<-conn.Done()
+
+		// Exiting with the appropriate code.
+		if err := conn.Err(); err != nil && !errors.Is(err, context.Canceled) {
+			exitWithPrintf(exitCodeConnectionLost, "Connection closed with error: %s", err.Error())
+		}
+		exitWithPrintf(exitCodeOK, "Disconnected from Rosenbridge.")
 	},
 }
 
@@ -48,10 +156,64 @@ func init() {
 
 	// Setting up the --client-id or -c flag.
 	connectCmd.Flags().StringVarP(&connectClientID, "client-id", "c", "",
-		"ID of the client making the connection.")
+		"ID of the client making the connection. Defaults to the client_id config.")
+
+	// Setting up the --output or -o flag.
+	connectCmd.Flags().StringVarP(&outputFormat, "output", "o", outputText, outputFlagUsage)
+
+	// Setting up the --drop-unverified flag.
+	connectCmd.Flags().BoolVar(&connectDropUnverified, "drop-unverified", false,
+		`Discard the incoming messages that are not signed by a trusted key of their sender, instead of showing them as
+unverified or forged. See "rosen keys".`)
 
-	// The --client-id flag is required.
-	if err := connectCmd.MarkFlagRequired("client-id"); err != nil {
-		panic(fmt.Errorf("failed to mark client-id flag as required: %w", err))
+	// Setting up the --exec flag and its companions.
+	connectCmd.Flags().StringVar(&connectExecCommand, "exec", "",
+		`Optional command to run for every incoming message. The message is passed on stdin, and the
+ROSEN_SENDER_ID, ROSEN_REQUEST_ID, ROSEN_CLIENT_ID, ROSEN_RECEIVED_AT and ROSEN_VERIFICATION environment variables
+are set.`)
+	connectCmd.Flags().IntVar(&connectExecConcurrency, "exec-concurrency", 1,
+		"Maximum number of commands running at the same time.")
+	connectCmd.Flags().DurationVar(&connectExecTimeout, "exec-timeout", 30*time.Second, //nolint:gomnd
+		"Maximum duration of a single command run, after which it is killed.")
+	connectCmd.Flags().StringVar(&connectExecOnFailure, "exec-on-failure", execOnFailureContinue,
+		"What to do when a command fails. One of: continue, exit.")
+	connectCmd.Flags().BoolVar(&connectExecReply, "exec-reply", false,
+		"Send the stdout of the command back to the sender as a reply, instead of printing it.")
+
+	// Setting up the --forward-url flag and its companions.
+	connectCmd.Flags().StringVar(&connectForwardURL, "forward-url", "",
+		"Optional webhook URL. Every incoming message is POSTed to it as JSON.")
+	connectCmd.Flags().StringArrayVar(&connectForwardHeaders, "forward-header", nil,
+		"Header to add to the webhook requests, in the 'Key: Value' form. Can be repeated.")
+	connectCmd.Flags().StringVar(&connectForwardSecret, "forward-secret", "",
+		`Secret for signing the webhook payloads with HMAC-SHA256. The signature is sent in the X-Rosen-Signature
+header. Prefer the forward.secret config to keep it out of the process list.`)
+	connectCmd.Flags().StringVar(&connectForwardDeadLetter, "forward-dead-letter", "",
+		"File where the messages that could not be forwarded are appended as JSON lines.")
+	connectCmd.Flags().DurationVar(&connectForwardTimeout, "forward-timeout", 10*time.Second, //nolint:gomnd
+		"Timeout of a single webhook request. Failed requests are retried as per the retry configs.")
+}
+
+// consumeMessages feeds all incoming messages of the connection to the executor and the forwarder, whichever are not
+// nil. It returns after the connection is closed, and all the running commands and queued forwards are complete.
+func consumeMessages(conn *lib.Connection, executor *messageExecutor, forwarder *webhookForwarder) {
+	for event := range conn.Messages() {
+		// Errors are already printed by the handler.
+		if event.Err != nil || event.Message == nil {
+			continue
+		}
+		if forwarder != nil {
+			forwarder.submit(event.Message)
+		}
+		if executor != nil {
+			executor.submit(event.Message)
+		}
+	}
+
+	if forwarder != nil {
+		forwarder.wait()
+	}
+	if executor != nil {
+		executor.wait()
 	}
 }
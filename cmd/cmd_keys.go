@@ -0,0 +1,251 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/shivanshkc/rosenbridge-cli/lib"
+
+	"github.com/spf13/cobra"
+)
+
+// keysClientID binds with the client ID flag of the keys generate and export commands.
+var keysClientID string
+
+// keysGenerateForce binds with the --force flag of the keys generate command.
+var keysGenerateForce bool
+
+// keysImportForce binds with the --force flag of the keys import command.
+var keysImportForce bool
+
+// keysCmd represents the keys command.
+var keysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "Manages the keys for the end-to-end encryption and the signing of messages.",
+	Long: `Manages the keys for the end-to-end encryption and the signing of messages.
+
+Every client has its own key pairs, whose public keys are shared with the peers using "rosen keys export" and
+"rosen keys import". Messages sent with "rosen send --encrypt" can then only be read by their receivers, and not by
+Rosenbridge. Messages sent with "rosen send --sign" are verified by their receivers, proving who sent them.
+The keys are kept in the file given by the keys.file config, which defaults to $HOME/.rosen-keys.json.`,
+}
+
+// keysGenerateCmd represents the keys generate command.
+var keysGenerateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Generates the encryption and signing key pairs for a client.",
+	Long:  ``,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		clientID := resolveClientID(keysClientID, "client-id")
+		if err := checkClientID(clientID); err != nil {
+			exitWithPrintf(exitCodeFailure, err.Error())
+		}
+
+		store, err := readKeyStore()
+		if err != nil {
+			exitWithPrintf(exitCodeFailure, err.Error())
+		}
+
+		// Replacing a key pair makes the messages encrypted for the old one unreadable, so it requires --force.
+		_, hasKeyPair := store.KeyPairs[clientID]
+		_, hasSigningKeyPair := store.SigningKeyPairs[clientID]
+		if hasKeyPair && hasSigningKeyPair && !keysGenerateForce {
+			exitWithPrintf(exitCodeFailure, "Key pairs for %s already exist. Use --force to replace them.", clientID)
+		}
+
+		// Only the missing key pairs are generated, unless --force is given.
+		if !hasKeyPair || keysGenerateForce {
+			keyPair, err := lib.GenerateKeyPair()
+			if err != nil {
+				exitWithPrintf(exitCodeFailure, err.Error())
+			}
+			store.KeyPairs[clientID] = keyPair
+		}
+		if !hasSigningKeyPair || keysGenerateForce {
+			signingKeyPair, err := lib.GenerateSigningKeyPair()
+			if err != nil {
+				exitWithPrintf(exitCodeFailure, err.Error())
+			}
+			store.SigningKeyPairs[clientID] = signingKeyPair
+		}
+
+		if err := writeKeyStore(store); err != nil {
+			exitWithPrintf(exitCodeFailure, err.Error())
+		}
+
+		exitWithPrintf(exitCodeOK, "Generated key pairs for %s. Share their public keys using \"rosen keys export\".",
+			clientID)
+	},
+}
+
+// keysExportCmd represents the keys export command.
+var keysExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Prints the public keys of a client, in the form accepted by \"rosen keys import\".",
+	Long:  ``,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		clientID := resolveClientID(keysClientID, "client-id")
+
+		store, err := readKeyStore()
+		if err != nil {
+			exitWithPrintf(exitCodeFailure, err.Error())
+		}
+
+		keyPair, exists := store.KeyPairs[clientID]
+		if !exists {
+			exitWithPrintf(exitCodeFailure, "No key pair found for %s. Use \"rosen keys generate\" to create one.",
+				clientID)
+		}
+
+		// The signing key is left out for the clients generated before signing was supported.
+		if signingKeyPair, exists := store.SigningKeyPairs[clientID]; exists {
+			signingKey := base64.StdEncoding.EncodeToString(signingKeyPair.PublicKey)
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "%s %s %s\n", clientID, keyPair.PublicKey, signingKey)
+			return
+		}
+		_, _ = fmt.Fprintf(cmd.OutOrStdout(), "%s %s\n", clientID, keyPair.PublicKey)
+	},
+}
+
+// keysImportCmd represents the keys import command.
+var keysImportCmd = &cobra.Command{
+	Use:   "import [<client-id> <public-key> [<signing-key>]]",
+	Short: "Imports the public keys of peers.",
+	Long: `Imports the public keys of peers, so the messages sent to them can be encrypted, and the messages received
+from them can be verified.
+
+The keys of a single peer can be given as arguments. Otherwise, they are read from stdin, one
+"<client-id> <public-key> [<signing-key>]" line per peer, like the output of "rosen keys export". Empty lines and the
+ones starting with # are ignored.
+
+A key that differs from the one already imported for the peer could mean an impersonation attempt, so nothing is
+imported in that case, unless --force is given.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 1 || len(args) > 3 { //nolint:gomnd // Client ID and up to two keys.
+			return fmt.Errorf("accepts 0, 2 or 3 arg(s), received %d", len(args))
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		store, err := readKeyStore()
+		if err != nil {
+			exitWithPrintf(exitCodeFailure, err.Error())
+		}
+
+		var count int
+		importKeys := func(clientID string, encodedKeys []string) error {
+			imported, err := importPeerKeys(store, clientID, encodedKeys, keysImportForce)
+			count += imported
+			return err
+		}
+
+		if len(args) > 0 {
+			err = importKeys(args[0], args[1:])
+		} else {
+			err = readKeyLines(os.Stdin, importKeys)
+		}
+		if err != nil {
+			exitWithPrintf(exitCodeFailure, err.Error())
+		}
+
+		if err := writeKeyStore(store); err != nil {
+			exitWithPrintf(exitCodeFailure, err.Error())
+		}
+
+		exitWithPrintf(exitCodeOK, "Imported %d public key(s).", count)
+	},
+}
+
+// keysListCmd represents the keys list command.
+var keysListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists the key pairs of the clients, and the public keys of the peers.",
+	Long:  ``,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		store, err := readKeyStore()
+		if err != nil {
+			exitWithPrintf(exitCodeFailure, err.Error())
+		}
+
+		clientIDs := make([]string, 0, len(store.KeyPairs))
+		for clientID := range store.KeyPairs {
+			clientIDs = append(clientIDs, clientID)
+		}
+		sort.Strings(clientIDs)
+
+		writer := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0) //nolint:gomnd // Padding of the columns.
+		_, _ = fmt.Fprintln(writer, "CLIENT ID\tKIND\tPUBLIC KEY")
+		for _, clientID := range clientIDs {
+			_, _ = fmt.Fprintf(writer, "%s\t%s\t%s\n", clientID, "key pair", store.KeyPairs[clientID].PublicKey)
+		}
+		for _, clientID := range clientIDs {
+			if signingKeyPair, exists := store.SigningKeyPairs[clientID]; exists {
+				_, _ = fmt.Fprintf(writer, "%s\t%s\t%s\n", clientID, "signing key pair",
+					base64.StdEncoding.EncodeToString(signingKeyPair.PublicKey))
+			}
+		}
+		for _, clientID := range store.Peers.ClientIDs() {
+			key, _ := store.Peers.Get(clientID)
+			_, _ = fmt.Fprintf(writer, "%s\t%s\t%s\n", clientID, "peer", key)
+		}
+		for _, clientID := range store.Trusted.ClientIDs() {
+			key, _ := store.Trusted.Get(clientID)
+			_, _ = fmt.Fprintf(writer, "%s\t%s\t%s\n", clientID, "trusted", base64.StdEncoding.EncodeToString(key))
+		}
+		_ = writer.Flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(keysCmd)
+	keysCmd.AddCommand(keysGenerateCmd)
+	keysCmd.AddCommand(keysExportCmd)
+	keysCmd.AddCommand(keysImportCmd)
+	keysCmd.AddCommand(keysListCmd)
+
+	// Setting up the --client-id or -c flag.
+	for _, command := range []*cobra.Command{keysGenerateCmd, keysExportCmd} {
+		command.Flags().StringVarP(&keysClientID, "client-id", "c", "",
+			"ID of the client whose key pair is used. Defaults to the client_id config.")
+	}
+
+	// Setting up the --force flag.
+	keysGenerateCmd.Flags().BoolVar(&keysGenerateForce, "force", false,
+		"Replace the existing key pair. Messages encrypted for the old one can no longer be decrypted.")
+	keysImportCmd.Flags().BoolVar(&keysImportForce, "force", false,
+		"Replace the keys that differ from the ones already imported for the peers.")
+}
+
+// readKeyLines reads "<client-id> <public-key> [<signing-key>]" lines from the given reader, and passes them to the
+// given func.
+func readKeyLines(reader io.Reader, handle func(clientID string, encodedKeys []string) error) error {
+	scanner := bufio.NewScanner(reader)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 || len(fields) > 3 { //nolint:gomnd // Client ID and up to two keys.
+			return fmt.Errorf("line %d: expected \"<client-id> <public-key> [<signing-key>]\"", lineNumber)
+		}
+		if err := handle(fields[0], fields[1:]); err != nil {
+			return fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read keys: %w", err)
+	}
+	return nil
+}
@@ -10,11 +10,22 @@ import (
 
 var cfgFile string
 
+// configFlags maps the config keys to the persistent flags that override them.
+var configFlags = map[string]string{
+	"tls.ca_file":              "ca-file",
+	"tls.cert_file":            "cert",
+	"tls.key_file":             "key",
+	"tls.insecure_skip_verify": "insecure-skip-verify",
+}
+
 // rootCmd represents the base command when called without any subcommands.
 var rootCmd = &cobra.Command{
 	Use:   "rosen",
 	Short: "A distributed hub for real-time communication between servers.",
 	Long:  ``,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		cobra.CheckErr(profileErr)
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -30,6 +41,21 @@ func init() {
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "",
 		"config file (default is $HOME/.rosen.yaml)")
+
+	rootCmd.PersistentFlags().StringVar(&profileName, "profile", "",
+		"profile of the config file to use (default is the current_profile config, or the ROSEN_PROFILE env var)")
+
+	// Setting up the TLS flags. They override the tls configs.
+	rootCmd.PersistentFlags().String("ca-file", "", "PEM file of additional CA certificates to trust")
+	rootCmd.PersistentFlags().String("cert", "", "PEM file of the client certificate for mTLS")
+	rootCmd.PersistentFlags().String("key", "", "PEM file of the key of the client certificate for mTLS")
+	rootCmd.PersistentFlags().Bool("insecure-skip-verify", false, "skip the TLS certificate verification (insecure)")
+
+	for key, flagName := range configFlags {
+		if err := viper.BindPFlag(key, rootCmd.PersistentFlags().Lookup(flagName)); err != nil {
+			panic(fmt.Errorf("failed to bind %s flag: %w", flagName, err))
+		}
+	}
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -37,7 +63,32 @@ func initConfig() {
 	// Set the default config values.
 	viper.SetDefault("backend.base_url", "rosenbridge.ledgerkeep.com")
 	viper.SetDefault("backend.is_tls_enabled", true)
-	viper.SetDefault("general.cold_start_retry_count", 10) //nolint:gomnd // Default value.
+	viper.SetDefault("backend.ping_interval", "30s")
+	viper.SetDefault("backend.pong_timeout", "10s")
+	viper.SetDefault("backend.reconnect_enabled", true)
+	viper.SetDefault("backend.reconnect_max_attempts", 0)
+	viper.SetDefault("retry.max_attempts", 10) //nolint:gomnd // Default value.
+	viper.SetDefault("retry.initial_backoff", "500ms")
+	viper.SetDefault("retry.max_backoff", "10s")
+	viper.SetDefault("retry.max_elapsed", "1m")
+	viper.SetDefault("backend.dial_timeout", "30s")
+	// The optional configs are empty by default. They are set here so that "rosen config view" lists them, even if
+	// they are only provided through the env vars.
+	viper.SetDefault("backend.url", "")
+	viper.SetDefault("client_id", "")
+	viper.SetDefault("proxy.url", "")
+	viper.SetDefault("tls.server_name", "")
+	viper.SetDefault("forward.secret", "")
+	// The auth configs are empty by default. They are set here so that "rosen config view" lists them.
+	viper.SetDefault("auth.type", "")
+	viper.SetDefault("auth.token", "")
+	viper.SetDefault("auth.api_key", "")
+	viper.SetDefault("auth.api_key_header", defaultAPIKeyHeader)
+	viper.SetDefault("auth.username", "")
+	viper.SetDefault("auth.password", "")
+	viper.SetDefault("auth.helper", "")
+	// Empty means the default key store path, which is $HOME/.rosen-keys.json.
+	viper.SetDefault("keys.file", "")
 
 	if cfgFile != "" {
 		// Use config file from the flag.
@@ -53,10 +104,19 @@ func initConfig() {
 		viper.SetConfigName(".rosen")
 	}
 
-	viper.AutomaticEnv() // read in environment variables that match
+	// Reading in environment variables that match. For example, ROSEN_BACKEND_BASE_URL overrides backend.base_url.
+	viper.SetEnvPrefix(configEnvPrefix)
+	viper.SetEnvKeyReplacer(configEnvKeyReplacer)
+	viper.AutomaticEnv()
 
 	// If a config file is found, read it in.
 	if err := viper.ReadInConfig(); err == nil {
 		_, _ = fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
 	}
+
+	// Overlaying the selected profile, if any. The error is reported by the commands that need the profile.
+	profileErr = applyProfile()
+	if activeProfile != "" {
+		_, _ = fmt.Fprintln(os.Stderr, "Using profile:", activeProfile)
+	}
 }
@@ -5,8 +5,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/shivanshkc/rosenbridge-cli/lib"
@@ -18,7 +20,17 @@ import (
 )
 
 // These variables bind with the flags of the send command.
-var sendSenderID, sendReceiverIDs, sendInlineMessage string
+var sendSenderID, sendReceiverIDs, sendInlineMessage, sendSplit string
+
+// These variables bind with the batch flags of the send command.
+var (
+	sendFromFile, sendFileFormat, sendResultsFile string
+	sendParallelism                               int
+	sendRate                                      float64
+)
+
+// These variables bind with the --encrypt and --sign flags of the send command.
+var sendEncrypt, sendSign bool
 
 // sendCmd represents the send command.
 var sendCmd = &cobra.Command{
@@ -26,22 +38,57 @@ var sendCmd = &cobra.Command{
 	Short: "Sends a message or opens a console for writing multiple messages to the intended client.",
 	Long:  ``,
 	Run: func(cmd *cobra.Command, args []string) {
-		// Validating the inputs.
-		if err := checkClientID(sendSenderID); err != nil {
-			exitWithPrintf(1, err.Error())
+		if err := setupOutput(); err != nil {
+			exitWithPrintf(exitCodeFailure, err.Error())
 		}
 
-		// Converting comma-separated receiver ID list to slice.
-		receiverIDs := strings.Split(sendReceiverIDs, ",")
-		if err := checkClientIDSlice(receiverIDs); err != nil {
-			exitWithPrintf(1, err.Error())
+		// Validating the inputs.
+		sendSenderID = resolveClientID(sendSenderID, "sender")
+		if err := checkClientID(sendSenderID); err != nil {
+			exitWithPrintf(exitCodeFailure, err.Error())
 		}
 
 		// Creating connection params for sending messages.
 		params := &lib.ConnectionParams{
 			ClientID:     sendSenderID,
+			Endpoint:     getEndpoint(),
 			BaseURL:      viper.GetString("backend.base_url"),
 			IsTLSEnabled: viper.GetBool("backend.is_tls_enabled"),
+			Auth:         getAuthenticator(),
+			TLSConfig:    getTLSConfig(),
+			Proxy:        getProxy(),
+			DialTimeout:  viper.GetDuration("backend.dial_timeout"),
+		}
+		// The client is built once, so its connections are reused across the messages.
+		params.HTTPClient = lib.NewHTTPClient(params)
+		// All messages are encrypted for their receivers upon --encrypt.
+		if sendEncrypt {
+			params.Encryption = getEncryptionParams(sendSenderID, true)
+		}
+		// All messages are signed with the key of the sender upon --sign.
+		if sendSign {
+			params.Signing = getSigningParams(sendSenderID, true, false)
+		}
+
+		// If a batch file is provided, its messages are sent and the CLI exits.
+		// The receivers are optional here, as every line of the file may specify its own.
+		if sendFromFile != "" {
+			var receiverIDs []string
+			if sendReceiverIDs != "" {
+				receiverIDs = strings.Split(sendReceiverIDs, ",")
+			}
+			os.Exit(sendBatch(params, receiverIDs))
+		}
+
+		// The receivers are required for all other modes.
+		if sendReceiverIDs == "" {
+			exitWithPrintf(exitCodeFailure, "required flag \"receivers\" not set")
+		}
+
+		// Converting comma-separated receiver ID list to slice.
+		receiverIDs := strings.Split(sendReceiverIDs, ",")
+		if err := checkClientIDSlice(receiverIDs); err != nil {
+			exitWithPrintf(exitCodeFailure, err.Error())
 		}
 
 		// If inline message is provided, it is sent and the CLI exits.
@@ -54,22 +101,41 @@ var sendCmd = &cobra.Command{
 				SenderID:    params.ClientID,
 			}
 
-			// Sending the message whilst handling Cloud Run errors.
-			_ = sendMessageWithColdStartHandling(outgoingMessage, params)
-			return
+			// Sending the message whilst retrying the failures.
+			response, err := sendMessageWithRetries(outgoingMessage, params)
+			if err != nil {
+				os.Exit(exitCodeFailure)
+			}
+
+			// Exiting with a non-zero code if the message did not reach all receivers.
+			printDeliveryReport(outgoingMessage, response)
+			os.Exit(deliveryExitCode(response))
+		}
+
+		// If the stdin is piped, the messages are read from it without any prompts, and the CLI exits upon EOF.
+		if isStdinPipe() {
+			if err := validateSplit(sendSplit); err != nil {
+				exitWithPrintf(exitCodeFailure, err.Error())
+			}
+			os.Exit(sendFromPipe(os.Stdin, sendSplit, receiverIDs, params))
 		}
 
 		// Starting a console to read messages continuously.
 		reader := bufio.NewReader(os.Stdin)
 		for {
-			// Prompt.
-			fmt.Printf(">> You: ") //nolint:forbidigo
+			// Prompt. It goes to stderr as well when the output is machine-readable.
+			_, _ = fmt.Fprint(color.Output, ">> You: ")
 
 			// Reading the input.
 			messageBody, err := reader.ReadString('\n')
+			// EOF (Ctrl+D) closes the console.
+			if errors.Is(err, io.EOF) {
+				_, _ = fmt.Fprintln(color.Output)
+				return
+			}
 			if err != nil {
 				color.Red("Error while reading message: %s\n", err.Error())
-				return
+				os.Exit(exitCodeFailure)
 			}
 
 			// Remove trailing newline char.
@@ -82,49 +148,91 @@ var sendCmd = &cobra.Command{
 				SenderID:    params.ClientID,
 			}
 
-			// Sending the message whilst handling Cloud Run errors.
-			if err := sendMessageWithColdStartHandling(outgoingMessage, params); err != nil {
+			// Sending the message whilst retrying the failures.
+			response, err := sendMessageWithRetries(outgoingMessage, params)
+			if err != nil {
 				// Exit the CLI if message delivery fails.
 				break
 			}
+
+			printDeliveryReport(outgoingMessage, response)
 		}
 	},
 }
 
-// sendMessageWithColdStartHandling sends the given message using the given connection params.
-// It also handles GCP Cloud Run's annoying 429 errors.
-func sendMessageWithColdStartHandling(outMessage *lib.OutgoingMessageReq, params *lib.ConnectionParams) error {
-	// Number of max retries.
-	retryCount := viper.GetInt("general.cold_start_retry_count")
+// sendBatch sends all messages of the batch file as per the batch flags, and provides the exit code.
+func sendBatch(params *lib.ConnectionParams, defaultReceiverIDs []string) int {
+	if sendParallelism < 1 {
+		exitWithPrintf(exitCodeFailure, "parallelism must be at least 1")
+	}
+	if sendRate < 0 {
+		exitWithPrintf(exitCodeFailure, "rate cannot be negative")
+	}
 
-	// We only print cold-restart warning once, so a flag is required to keep track.
-	var isWarningPrinted bool
+	items, err := readBatchFile(sendFromFile, sendFileFormat, defaultReceiverIDs)
+	if err != nil {
+		exitWithPrintf(exitCodeFailure, err.Error())
+	}
 
-	// Starting the retry loop to deal with GCP cold-start errors.
-	for i := 0; i < retryCount; i++ {
-		// Sending the message.
-		_, err := lib.SendMessage(context.Background(), outMessage, params)
-		if err == nil {
-			return nil
+	// The results go to stdout unless a results file is provided.
+	results := io.Writer(os.Stdout)
+	if sendResultsFile != "" {
+		file, err := os.Create(sendResultsFile)
+		if err != nil {
+			exitWithPrintf(exitCodeFailure, "failed to create results file: %s", err.Error())
 		}
+		defer func() { _ = file.Close() }()
+		results = file
+	}
+
+	// Batch items are retried silently, as the warnings would interleave for parallel sends.
+	params.Retry = getRetryPolicy()
 
+	sender := &batchSender{
+		params:       params,
+		parallelism:  sendParallelism,
+		rate:         sendRate,
+		results:      results,
+		counts:       map[string]int{},
+		resultsMutex: &sync.Mutex{},
+	}
+
+	sender.run(items)
+	_, _ = fmt.Fprintln(color.Output, sender.summary())
+	return sender.exitCode()
+}
+
+// sendMessageWithRetries sends the given message using the given connection params.
+// Failures, like GCP Cloud Run's annoying 429 errors, are retried as per the retry configs.
+func sendMessageWithRetries(outMessage *lib.OutgoingMessageReq, params *lib.ConnectionParams) (
+	*lib.OutgoingMessageRes, error,
+) {
+	// We only print the retry warning once, so a flag is required to keep track.
+	var isWarningPrinted bool
+
+	retryPolicy := getRetryPolicy()
+	retryPolicy.OnRetry = func(attempt int, delay time.Duration, err error) {
 		// This will be logged upon every failure.
 		color.Red("Error while sending message: %s\n", err.Error())
+		if !isWarningPrinted {
+			color.Yellow("Looks like the server is under load. Retrying up to %d times...", retryPolicy.MaxAttempts-1)
+		}
+		isWarningPrinted = true
+	}
 
-		// If the error is 429, we attempt a retry.
-		if errors.Is(err, lib.ErrTooManyReq) {
-			if !isWarningPrinted {
-				color.Yellow("Looks like the server is under load. Retrying %d times...", retryCount)
-			}
-
-			isWarningPrinted = true
-			time.Sleep(time.Second)
+	// Sending the message.
+	params.Retry = retryPolicy
+	response, err := lib.SendMessage(context.Background(), outMessage, params)
+	if err != nil {
+		color.Red("Error while sending message: %s\n", err.Error())
+		// Retries didn't work.
+		if isWarningPrinted {
+			color.Red("The server is busy. Please try again in some time.")
 		}
+		return nil, errors.New("failed to send message")
 	}
 
-	// Retries didn't work.
-	color.Red("The server is busy. Please try again in some time.")
-	return errors.New("failed to send message")
+	return response, nil
 }
 
 func init() {
@@ -132,24 +240,55 @@ func init() {
 
 	// Setting up the --sender or -s flag.
 	sendCmd.Flags().StringVarP(&sendSenderID, "sender", "s", "",
-		"ID of the client sending the message(s).")
-
-	// The --sender flag is required.
-	if err := sendCmd.MarkFlagRequired("sender"); err != nil {
-		panic(fmt.Errorf("failed to mark sender flag as required: %w", err))
-	}
+		"ID of the client sending the message(s). Defaults to the client_id config.")
 
 	// Setting up the --receivers or -r flag.
 	sendCmd.Flags().StringVarP(&sendReceiverIDs, "receivers", "r", "",
 		"Comma-separated list of client IDs that are intended to receive the message(s).")
 
-	// The --receivers flag is required.
-	if err := sendCmd.MarkFlagRequired("receivers"); err != nil {
-		panic(fmt.Errorf("failed to mark receivers flag as required: %w", err))
-	}
+	// The --receivers flag is required, unless --from-file is provided. This is validated in the Run func.
 
 	// Setting up the --message or -m flag.
 	sendCmd.Flags().StringVarP(&sendInlineMessage, "message", "m", "",
 		`Optional message. If provided, the message is sent and the CLI exits. Otherwise, a console is opened to
 write multiple messages.`)
+
+	// Setting up the --split flag.
+	sendCmd.Flags().StringVar(&sendSplit, "split", splitNewline,
+		`How the piped stdin is split into messages: "newline", "nul", "none" (the whole input is one message), or any
+other string to be used as a custom delimiter.`)
+
+	// Setting up the --from-file flag.
+	sendCmd.Flags().StringVar(&sendFromFile, "from-file", "",
+		`Optional JSONL or CSV file of messages. If provided, every line is sent as a separate message and the CLI exits.
+Each line has the receiver_ids, message and (optionally) request_id fields. Lines without receivers use --receivers.`)
+
+	// Setting up the --file-format flag.
+	sendCmd.Flags().StringVar(&sendFileFormat, "file-format", "",
+		"Format of the --from-file, either jsonl or csv. It is detected from the file extension by default.")
+
+	// Setting up the --parallel flag.
+	sendCmd.Flags().IntVar(&sendParallelism, "parallel", 1,
+		"Number of messages of the --from-file that are sent at the same time.")
+
+	// Setting up the --rate flag.
+	sendCmd.Flags().Float64Var(&sendRate, "rate", 0,
+		"Maximum number of messages of the --from-file sent per second. Zero means no limit.")
+
+	// Setting up the --results-file flag.
+	sendCmd.Flags().StringVar(&sendResultsFile, "results-file", "",
+		"File to which the JSONL results of the --from-file are written. Defaults to stdout.")
+
+	// Setting up the --encrypt flag.
+	sendCmd.Flags().BoolVar(&sendEncrypt, "encrypt", false,
+		`Encrypt the message(s) end-to-end, so only the receivers can read them. Requires a key pair for the sender,
+and the public keys of all receivers. See "rosen keys".`)
+
+	// Setting up the --sign flag.
+	sendCmd.Flags().BoolVar(&sendSign, "sign", false,
+		`Sign the message(s), so the receivers can verify that they come from the sender. Requires a signing key pair
+for the sender. See "rosen keys".`)
+
+	// Setting up the --output or -o flag.
+	sendCmd.Flags().StringVarP(&outputFormat, "output", "o", outputText, outputFlagUsage)
 }
@@ -0,0 +1,202 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configFilePermissions are the permissions of a newly created config file. It may hold secrets, so it is private.
+const configFilePermissions = 0o600
+
+// getConfigFilePath provides the path of the config file, whether it exists or not.
+func getConfigFilePath() (string, error) {
+	if cfgFile != "" {
+		return cfgFile, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".rosen.yaml"), nil
+}
+
+// updateConfigFile applies the given update to the root mapping of the config file and writes it back.
+//
+// The file is edited as a YAML node tree, so the comments and the order of the keys are preserved. The defaults, env
+// vars and profile overlays never leak into the file. The write is atomic, so a failure can't corrupt the file.
+func updateConfigFile(update func(root *yaml.Node) error) error {
+	path, err := getConfigFilePath()
+	if err != nil {
+		return err
+	}
+
+	// A missing file is fine, it is created upon writing.
+	content, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	document := &yaml.Node{}
+	if err := yaml.Unmarshal(content, document); err != nil {
+		return fmt.Errorf("failed to parse config file: %w", err)
+	}
+
+	// An empty file has no document at all.
+	if document.Kind == 0 {
+		document = &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	root := document.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return errors.New("config file must be a yaml mapping")
+	}
+
+	if err := update(root); err != nil {
+		return err
+	}
+
+	buffer := &bytes.Buffer{}
+	encoder := yaml.NewEncoder(buffer)
+	encoder.SetIndent(2) //nolint:gomnd // Indentation of the README examples.
+	if err := encoder.Encode(document); err != nil {
+		return fmt.Errorf("failed to encode config file: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return fmt.Errorf("failed to encode config file: %w", err)
+	}
+
+	return writeFileAtomically(path, buffer.Bytes())
+}
+
+// writeFileAtomically writes the given content to the given path through a temporary file, so the path either has the
+// old content or the new one, never a partial write. The permissions of an existing file are preserved.
+func writeFileAtomically(path string, content []byte) error {
+	permissions := fs.FileMode(configFilePermissions)
+	if info, err := os.Stat(path); err == nil {
+		permissions = info.Mode().Perm()
+	}
+
+	tempFile, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	// The temporary file is removed if anything fails. After a successful rename, this is a no-op.
+	defer func() { _ = os.Remove(tempFile.Name()) }()
+
+	if _, err := tempFile.Write(content); err != nil {
+		_ = tempFile.Close()
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	if err := tempFile.Sync(); err != nil {
+		_ = tempFile.Close()
+		return fmt.Errorf("failed to sync temporary file: %w", err)
+	}
+	if err := tempFile.Close(); err != nil {
+		return fmt.Errorf("failed to close temporary file: %w", err)
+	}
+	if err := os.Chmod(tempFile.Name(), permissions); err != nil {
+		return fmt.Errorf("failed to set file permissions: %w", err)
+	}
+
+	if err := os.Rename(tempFile.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace file: %w", err)
+	}
+	return nil
+}
+
+// lookupConfigNode provides the value node of the given dot-separated key within the given mapping.
+// It returns nil if the key does not exist. Keys are matched case-insensitively, like viper does.
+func lookupConfigNode(mapping *yaml.Node, key string) *yaml.Node {
+	node := mapping
+	for _, part := range strings.Split(key, ".") {
+		if node.Kind != yaml.MappingNode {
+			return nil
+		}
+		index := findMappingKey(node, part)
+		if index < 0 {
+			return nil
+		}
+		node = node.Content[index+1]
+	}
+	return node
+}
+
+// setConfigNode sets the given dot-separated key within the given mapping to the given scalar value.
+// The missing parent mappings are created. The type of the value is inferred as YAML would, so "true" is a boolean.
+func setConfigNode(mapping *yaml.Node, key string, value string) error {
+	parts := strings.Split(key, ".")
+
+	node := mapping
+	for i, part := range parts {
+		index := findMappingKey(node, part)
+
+		// The last part holds the value.
+		if i == len(parts)-1 {
+			valueNode := &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+			if index < 0 {
+				node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: part}, valueNode)
+				return nil
+			}
+			// Keeping the comments of the old value.
+			valueNode.LineComment = node.Content[index+1].LineComment
+			node.Content[index+1] = valueNode
+			return nil
+		}
+
+		if index < 0 {
+			child := &yaml.Node{Kind: yaml.MappingNode}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: part}, child)
+			node = child
+			continue
+		}
+
+		node = node.Content[index+1]
+		if node.Kind != yaml.MappingNode {
+			return fmt.Errorf("cannot set %q, as %q is not a mapping", key, strings.Join(parts[:i+1], "."))
+		}
+	}
+
+	return nil
+}
+
+// unsetConfigNode removes the given dot-separated key from the given mapping, along with the parent mappings that
+// become empty. It tells if the key existed.
+func unsetConfigNode(mapping *yaml.Node, key string) bool {
+	parts := strings.Split(key, ".")
+
+	index := findMappingKey(mapping, parts[0])
+	if index < 0 {
+		return false
+	}
+
+	if len(parts) > 1 {
+		child := mapping.Content[index+1]
+		if child.Kind != yaml.MappingNode || !unsetConfigNode(child, strings.Join(parts[1:], ".")) {
+			return false
+		}
+		// The parent is kept while it has other keys.
+		if len(child.Content) > 0 {
+			return true
+		}
+	}
+
+	mapping.Content = append(mapping.Content[:index], mapping.Content[index+2:]...)
+	return true
+}
+
+// findMappingKey provides the index of the given key node within the content of the given mapping, or -1.
+func findMappingKey(mapping *yaml.Node, key string) int {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if strings.EqualFold(mapping.Content[i].Value, key) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// configEnvPrefix is the prefix of the env vars that override the configs. For example, ROSEN_BACKEND_BASE_URL
+// overrides backend.base_url.
+const configEnvPrefix = "ROSEN"
+
+// configEnvKeyReplacer converts the nested config keys to their env var form.
+var configEnvKeyReplacer = strings.NewReplacer(".", "_")
+
+// maskedConfigValue replaces the values of the secret configs in the outputs.
+const maskedConfigValue = "********"
+
+// Sources of the config values.
+const (
+	configSourceDefault = "default"
+	configSourceFile    = "file"
+	configSourceProfile = "profile"
+	configSourceEnv     = "env"
+	configSourceFlag    = "flag"
+)
+
+// defaultConfigFileContent is the content written by "rosen config init".
+const defaultConfigFileContent = `---
+backend:
+  # Full URL of the rosenbridge deployment, with an optional path prefix. If set, base_url and is_tls_enabled are ignored.
+  # url: https://gw.example.com/rosen/
+  # Base URL of the rosenbridge deployment WITHOUT protocol (http, https, ws, wss etc)
+  base_url: rosenbridge.ledgerkeep.com
+  # Flag to specify if the target rosenbridge deployment is using TLS.
+  is_tls_enabled: true
+  # Interval at which "rosen connect" pings the server to keep the connection alive. Use "0s" to disable pinging.
+  ping_interval: 30s
+  # If nothing (not even a pong) is received for ping_interval + pong_timeout, the connection is considered stale.
+  pong_timeout: 10s
+  # Flag to specify if "rosen connect" should automatically reconnect when the connection breaks.
+  reconnect_enabled: true
+  # Number of consecutive failed reconnection attempts after which the CLI gives up. Zero means infinite attempts.
+  reconnect_max_attempts: 0
+
+# Failed operations (429, 502, 503, 504 and transient network errors) are retried with exponential backoff.
+retry:
+  # Maximum number of attempts, including the first one.
+  max_attempts: 10
+  # Delay before the first retry. It grows exponentially with every failed attempt.
+  initial_backoff: 500ms
+  # Upper limit of the delay between two attempts.
+  max_backoff: 10s
+  # Overall time budget for all attempts.
+  max_elapsed: 1m
+
+# Credentials of the deployment, if it requires any. Prefer the env vars, like ROSEN_AUTH_TOKEN, for the secrets.
+# auth:
+#   # One of: bearer, api_key, basic, helper, none. If not set, it is inferred from the other configs.
+#   type: helper
+#   # Command that prints the token.
+#   helper: cat ~/.rosen-token
+`
+
+// configValue is the effective value of a config key, along with where it came from.
+type configValue struct {
+	// Key is the dot-separated config key.
+	Key string
+	// Value is the effective value.
+	Value interface{}
+	// Source tells where the value came from, like "default" or "env ROSEN_BACKEND_BASE_URL".
+	Source string
+}
+
+// getConfigEnvVar provides the name of the env var that overrides the given config key.
+func getConfigEnvVar(key string) string {
+	return configEnvPrefix + "_" + strings.ToUpper(configEnvKeyReplacer.Replace(key))
+}
+
+// getConfigValues provides the effective values of all config keys, sorted by the keys.
+// The profile definitions are left out, as their values are already reflected through the profile overlay.
+func getConfigValues() []*configValue {
+	fileConfig := readConfigFileOnly()
+
+	var values []*configValue
+	for _, key := range viper.AllKeys() {
+		if strings.HasPrefix(key, profilesKey+".") {
+			continue
+		}
+		values = append(values, getConfigValue(key, fileConfig))
+	}
+
+	sort.Slice(values, func(i, j int) bool { return values[i].Key < values[j].Key })
+	return values
+}
+
+// getConfigValue provides the effective value of the given config key and its source.
+// The fileConfig must hold only the contents of the config file, as provided by readConfigFileOnly.
+func getConfigValue(key string, fileConfig *viper.Viper) *configValue {
+	key = strings.ToLower(key)
+	value := &configValue{Key: key, Value: viper.Get(key)}
+
+	// The sources are checked in the order of their precedence.
+	flagName, isFlagBound := configFlags[key]
+	envVar := getConfigEnvVar(key)
+	switch _, isEnvSet := os.LookupEnv(envVar); {
+	case isFlagBound && rootCmd.PersistentFlags().Changed(flagName):
+		value.Source = configSourceFlag + " --" + flagName
+	case isEnvSet:
+		value.Source = configSourceEnv + " " + envVar
+	case activeProfile != "" && fileConfig.IsSet(profilesKey+"."+activeProfile+"."+key):
+		value.Source = configSourceProfile + " " + activeProfile
+	case fileConfig.IsSet(key):
+		value.Source = configSourceFile
+	default:
+		value.Source = configSourceDefault
+	}
+
+	return value
+}
+
+// readConfigFileOnly provides a viper instance holding only the contents of the config file in use.
+// It is empty if no config file is in use.
+func readConfigFileOnly() *viper.Viper {
+	fileConfig := viper.New()
+	if path := viper.ConfigFileUsed(); path != "" {
+		fileConfig.SetConfigFile(path)
+		fileConfig.SetConfigType("yaml")
+		// The file was already read successfully by initConfig, so errors are not expected here.
+		_ = fileConfig.ReadInConfig()
+	}
+	return fileConfig
+}
+
+// formatConfigValue provides the printable form of the given config value.
+// The values of the secret configs are masked, unless reveal is true.
+func formatConfigValue(key string, value interface{}, reveal bool) string {
+	if value == nil {
+		return ""
+	}
+	// Empty secrets are shown as they are, to tell that they are not set.
+	if !reveal && isSecretConfigKey(key) && fmt.Sprint(value) != "" {
+		return maskedConfigValue
+	}
+
+	// Nested values are printed as YAML.
+	if _, isMap := value.(map[string]interface{}); isMap {
+		content, err := yaml.Marshal(value)
+		if err != nil {
+			return fmt.Sprint(value)
+		}
+		return strings.TrimSuffix(string(content), "\n")
+	}
+
+	return fmt.Sprint(value)
+}
+
+// isSecretConfigKey tells if the given config key holds a secret, like a signing secret or a token.
+func isSecretConfigKey(key string) bool {
+	parts := strings.Split(strings.ToLower(key), ".")
+	last := parts[len(parts)-1]
+
+	for _, marker := range []string{"secret", "token", "password", "api_key"} {
+		if strings.HasSuffix(last, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// getConfigTargetKey provides the key within the config file that "rosen config set/unset" must modify.
+// It is the key within the profile if the --profile flag is provided, otherwise the top-level key.
+func getConfigTargetKey(key string) string {
+	if profileName != "" {
+		return profilesKey + "." + profileName + "." + key
+	}
+	return key
+}
@@ -0,0 +1,183 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shivanshkc/rosenbridge-cli/lib"
+
+	"github.com/fatih/color"
+	"github.com/google/uuid"
+)
+
+// Supported values of the --exec-on-failure flag.
+const (
+	execOnFailureContinue = "continue"
+	execOnFailureExit     = "exit"
+)
+
+// messageExecutor runs a command for every incoming message.
+type messageExecutor struct {
+	// command is the shell command to be executed.
+	command string
+	// timeout is the maximum duration of a single execution.
+	timeout time.Duration
+	// onFailure decides what happens when an execution fails.
+	onFailure string
+	// reply tells if the stdout of the command should be sent back to the sender.
+	reply bool
+	// conn is the connection over which the replies are sent.
+	conn *lib.Connection
+
+	// slots limits the number of concurrent executions.
+	slots chan struct{}
+	// inFlight tracks the running executions, so they can be drained before exiting.
+	inFlight *sync.WaitGroup
+
+	// failed is set when an execution fails.
+	failed bool
+	// failedMutex guards the failed field.
+	failedMutex *sync.Mutex
+}
+
+// newMessageExecutor creates a new messageExecutor.
+func newMessageExecutor(conn *lib.Connection, command string, concurrency int, timeout time.Duration,
+	onFailure string, reply bool,
+) (*messageExecutor, error) {
+	if err := checkExecFlags(concurrency, onFailure); err != nil {
+		return nil, err
+	}
+
+	return &messageExecutor{
+		command:     command,
+		timeout:     timeout,
+		onFailure:   onFailure,
+		reply:       reply,
+		conn:        conn,
+		slots:       make(chan struct{}, concurrency),
+		inFlight:    &sync.WaitGroup{},
+		failedMutex: &sync.Mutex{},
+	}, nil
+}
+
+// checkExecFlags checks the concurrency and the failure policy of the executions.
+func checkExecFlags(concurrency int, onFailure string) error {
+	if concurrency < 1 {
+		return fmt.Errorf("exec concurrency should be at least 1, got %d", concurrency)
+	}
+	if onFailure != execOnFailureContinue && onFailure != execOnFailureExit {
+		return fmt.Errorf("unknown exec failure policy %q, use one of: %s, %s", onFailure,
+			execOnFailureContinue, execOnFailureExit)
+	}
+	return nil
+}
+
+// submit runs the command for the given message in the background.
+// It blocks while the maximum number of executions are already running.
+func (e *messageExecutor) submit(inMessage *lib.IncomingMessageReq) {
+	e.slots <- struct{}{}
+	e.inFlight.Add(1)
+
+	go func() {
+		defer func() { <-e.slots }()
+		defer e.inFlight.Done()
+
+		if err := e.execute(inMessage); err != nil {
+			color.Red(">> [%s] Command failed for message from %s: %s\n", time.Now().Format(time.Kitchen),
+				inMessage.SenderID, err.Error())
+			e.fail()
+		}
+	}()
+}
+
+// wait blocks until all running executions are complete.
+func (e *messageExecutor) wait() {
+	e.inFlight.Wait()
+}
+
+// hasFailed tells if any execution has failed.
+func (e *messageExecutor) hasFailed() bool {
+	e.failedMutex.Lock()
+	defer e.failedMutex.Unlock()
+	return e.failed
+}
+
+// fail records a failed execution, and closes the connection if the failure policy says so.
+func (e *messageExecutor) fail() {
+	e.failedMutex.Lock()
+	e.failed = true
+	e.failedMutex.Unlock()
+
+	if e.onFailure == execOnFailureExit {
+		_ = e.conn.Close()
+	}
+}
+
+// execute runs the command for the given message.
+//
+// The message body is passed on stdin, and its metadata as environment variables. If replies are enabled, the stdout
+// of the command is sent back to the sender. Otherwise, it is passed through to the stdout of the CLI.
+func (e *messageExecutor) execute(inMessage *lib.IncomingMessageReq) error {
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+
+	command := shellCommand(ctx, e.command)
+	command.Stdin = strings.NewReader(inMessage.Message)
+	command.Stderr = os.Stderr
+	command.Env = append(os.Environ(),
+		"ROSEN_SENDER_ID="+inMessage.SenderID,
+		"ROSEN_REQUEST_ID="+inMessage.RequestID,
+		"ROSEN_CLIENT_ID="+connectClientID,
+		"ROSEN_RECEIVED_AT="+time.Now().Format(time.RFC3339),
+		"ROSEN_VERIFICATION="+string(inMessage.Verification),
+	)
+
+	stdout := &bytes.Buffer{}
+	command.Stdout = os.Stdout
+	if e.reply {
+		command.Stdout = stdout
+	}
+
+	if err := command.Run(); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("timed out after %s: %w", e.timeout, err)
+		}
+		return fmt.Errorf("error in command execution: %w", err)
+	}
+
+	// Nothing to reply with.
+	if !e.reply || stdout.Len() == 0 {
+		return nil
+	}
+
+	reply := &lib.OutgoingMessageReq{
+		RequestID:   uuid.NewString(),
+		ReceiverIDs: []string{inMessage.SenderID},
+		Message:     strings.TrimSuffix(stdout.String(), "\n"),
+	}
+
+	response, err := e.conn.SendMessage(ctx, reply)
+	if err != nil {
+		return fmt.Errorf("failed to send reply: %w", err)
+	}
+	if err := response.Err(); err != nil {
+		return fmt.Errorf("failed to deliver reply: %w", err)
+	}
+	return nil
+}
+
+// shellCommand creates a command that runs the given command line through the shell of the OS.
+func shellCommand(ctx context.Context, commandLine string) *exec.Cmd {
+	// Running the user provided command is the whole point here.
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", commandLine) //nolint:gosec
+	}
+	return exec.CommandContext(ctx, "sh", "-c", commandLine) //nolint:gosec
+}
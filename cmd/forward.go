@@ -0,0 +1,239 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shivanshkc/rosenbridge-cli/lib"
+
+	"github.com/fatih/color"
+)
+
+// forwardSignatureHeader is the header that carries the HMAC signature of the forwarded payload.
+const forwardSignatureHeader = "X-Rosen-Signature"
+
+// forwardQueueSize is the number of messages that can wait to be forwarded, before the connection stops reading more.
+const forwardQueueSize = 64
+
+// forwardBufferSize is the size of the messages channel of the connection, when the messages are only forwarded.
+const forwardBufferSize = 16
+
+// forwardPayload is the JSON body that is POSTed to the webhook for every incoming message.
+type forwardPayload struct {
+	// SenderID is the ID of the client who sent the message.
+	SenderID string `json:"sender_id"`
+	// ReceiverID is the ID of the client who received the message, i.e. the one running the CLI.
+	ReceiverID string `json:"receiver_id"`
+	// RequestID is the ID of the request with which the message was sent.
+	RequestID string `json:"request_id,omitempty"`
+	// Message is the message body.
+	Message string `json:"message"`
+	// Verification tells if the message is proven to come from its sender: verified, unverified or forged.
+	Verification string `json:"verification,omitempty"`
+	// ReceivedAt is the RFC3339 time at which the message was received.
+	ReceivedAt string `json:"received_at"`
+}
+
+// deadLetter is a line of the dead-letter file.
+type deadLetter struct {
+	*forwardPayload
+	// Error is the reason why the message could not be forwarded.
+	Error string `json:"error"`
+	// FailedAt is the RFC3339 time at which forwarding was given up.
+	FailedAt string `json:"failed_at"`
+}
+
+// webhookForwarder POSTs incoming messages to a webhook.
+type webhookForwarder struct {
+	// url is the endpoint of the webhook.
+	url string
+	// headers are added to every request.
+	headers http.Header
+	// secret, if not empty, is used to sign the payloads with HMAC-SHA256.
+	secret []byte
+	// deadLetterPath, if not empty, is the file where the messages that could not be forwarded are appended.
+	deadLetterPath string
+	// retryPolicy decides how the failed requests are retried.
+	retryPolicy *lib.RetryPolicy
+	// httpClient is shared by all requests, so the connections are reused.
+	httpClient *http.Client
+
+	// queue holds the messages waiting to be forwarded.
+	queue chan *forwardPayload
+	// doneChan is closed when all the queued messages are handled, after the queue is closed.
+	doneChan chan struct{}
+
+	// deadLetterMutex serializes the writes to the dead-letter file.
+	deadLetterMutex *sync.Mutex
+}
+
+// newWebhookForwarder creates a new webhookForwarder, and starts forwarding the submitted messages in the background.
+// The headers are expected in the "Key: Value" form.
+func newWebhookForwarder(url string, headers []string, secret string, deadLetterPath string,
+	timeout time.Duration,
+) (*webhookForwarder, error) {
+	parsedHeaders := http.Header{}
+	for _, header := range headers {
+		key, value, found := cutString(header, ":")
+		if !found || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("invalid forward header %q, it should be of the form 'Key: Value'", header)
+		}
+		parsedHeaders.Add(strings.TrimSpace(key), strings.TrimSpace(value))
+	}
+
+	retryPolicy := getRetryPolicy()
+	retryPolicy.IsRetryable = isForwardRetryable
+
+	forwarder := &webhookForwarder{
+		url:             url,
+		headers:         parsedHeaders,
+		secret:          []byte(secret),
+		deadLetterPath:  deadLetterPath,
+		retryPolicy:     retryPolicy,
+		httpClient:      &http.Client{Timeout: timeout},
+		queue:           make(chan *forwardPayload, forwardQueueSize),
+		doneChan:        make(chan struct{}),
+		deadLetterMutex: &sync.Mutex{},
+	}
+
+	go forwarder.run()
+	return forwarder, nil
+}
+
+// submit queues the given message to be forwarded in the background.
+// It blocks while the queue is full, that is, while the webhook is slower than the incoming messages.
+func (f *webhookForwarder) submit(inMessage *lib.IncomingMessageReq) {
+	f.queue <- &forwardPayload{
+		SenderID:     inMessage.SenderID,
+		ReceiverID:   connectClientID,
+		RequestID:    inMessage.RequestID,
+		Message:      inMessage.Message,
+		Verification: string(inMessage.Verification),
+		ReceivedAt:   time.Now().Format(time.RFC3339),
+	}
+}
+
+// wait stops accepting messages, and blocks until all the queued ones are forwarded or dead-lettered.
+func (f *webhookForwarder) wait() {
+	close(f.queue)
+	<-f.doneChan
+}
+
+// run forwards the queued messages one by one, so they reach the webhook in order. It returns once the queue is closed
+// and drained.
+func (f *webhookForwarder) run() {
+	defer close(f.doneChan)
+
+	for payload := range f.queue {
+		// A detached context is used, so that an interruption does not abort the in-flight forward.
+		if err := f.forward(context.Background(), payload); err != nil {
+			color.Red(">> [%s] Failed to forward message from %s: %s\n", time.Now().Format(time.Kitchen),
+				payload.SenderID, err.Error())
+			f.writeDeadLetter(payload, err)
+		}
+	}
+}
+
+// forward POSTs the given payload to the webhook, retrying the failures as per the retry policy.
+func (f *webhookForwarder) forward(ctx context.Context, payload *forwardPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	return f.retryPolicy.Do(ctx, func(ctx context.Context) error {
+		request, err := http.NewRequestWithContext(ctx, http.MethodPost, f.url, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("failed to form the http request: %w", err)
+		}
+
+		request.Header = f.headers.Clone()
+		request.Header.Set("content-type", "application/json")
+		if payload.RequestID != "" {
+			request.Header.Set("x-request-id", payload.RequestID)
+		}
+		if len(f.secret) > 0 {
+			request.Header.Set(forwardSignatureHeader, "sha256="+signPayload(f.secret, body))
+		}
+
+		response, err := f.httpClient.Do(request)
+		if err != nil {
+			return fmt.Errorf("failed to execute http request: %w", err)
+		}
+		defer func() { _ = response.Body.Close() }()
+
+		if response.StatusCode/100 != 2 { //nolint:gomnd // These are not magic numbers.
+			responseBody, _ := io.ReadAll(io.LimitReader(response.Body, 1024)) //nolint:gomnd // Enough for errors.
+			return &lib.StatusError{StatusCode: response.StatusCode, Body: string(responseBody)}
+		}
+		return nil
+	})
+}
+
+// writeDeadLetter appends the given payload and its failure reason to the dead-letter file, if one is configured.
+func (f *webhookForwarder) writeDeadLetter(payload *forwardPayload, reason error) {
+	if f.deadLetterPath == "" {
+		return
+	}
+
+	line, err := json.Marshal(&deadLetter{
+		forwardPayload: payload,
+		Error:          reason.Error(),
+		FailedAt:       time.Now().Format(time.RFC3339),
+	})
+	if err != nil {
+		color.Red("Failed to marshal dead letter: %s\n", err.Error())
+		return
+	}
+
+	f.deadLetterMutex.Lock()
+	defer f.deadLetterMutex.Unlock()
+
+	file, err := os.OpenFile(f.deadLetterPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600) //nolint:gomnd
+	if err != nil {
+		color.Red("Failed to open dead-letter file: %s\n", err.Error())
+		return
+	}
+	defer func() { _ = file.Close() }()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		color.Red("Failed to write dead letter: %s\n", err.Error())
+	}
+}
+
+// isForwardRetryable tells if a failed forward is worth a retry.
+// Unlike the Rosenbridge API, all 5xx errors of the webhook are retried.
+func isForwardRetryable(err error) bool {
+	var statusErr *lib.StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= http.StatusInternalServerError
+	}
+	return lib.DefaultIsRetryable(err)
+}
+
+// signPayload provides the hex encoded HMAC-SHA256 of the given payload.
+func signPayload(secret []byte, payload []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	_, _ = mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// cutString slices the given string around the first instance of the separator.
+func cutString(s, sep string) (before, after string, found bool) {
+	if index := strings.Index(s, sep); index >= 0 {
+		return s[:index], s[index+len(sep):], true
+	}
+	return s, "", false
+}
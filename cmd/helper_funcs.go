@@ -2,17 +2,18 @@ package cmd
 
 import (
 	"context"
+	"fmt"
+	"net/url"
 	"os"
 	"time"
 
 	"github.com/shivanshkc/rosenbridge-cli/lib"
 
 	"github.com/fatih/color"
+	"github.com/spf13/viper"
 )
 
 // exitWithPrintf prints the provided message in Printf style and then calls os.Exit with provided code.
-//
-//nolint:unparam
 func exitWithPrintf(code int, format string, a ...interface{}) {
 	switch code {
 	case 0:
@@ -26,13 +27,215 @@ func exitWithPrintf(code int, format string, a ...interface{}) {
 // printMessage prints the provided message in appropriate format.
 // If the provided message is nil, it prints that the message is ill-formatted.
 func printMessage(ctx context.Context, inMessage *lib.IncomingMessageReq, err error) {
+	if !printer.isText() {
+		printMessageRecord(inMessage, err)
+		return
+	}
+
 	if err != nil {
-		color.Red(">> [%s] Error while reading the message: %s\n", err.Error())
+		color.Red(">> [%s] Error while reading the message: %s\n", time.Now().Format(time.Kitchen), err.Error())
 		return
 	}
 	if inMessage == nil {
 		color.Red(">> [%s] Message is of unrecognized format.\n", time.Now().Format(time.Kitchen))
 		return
 	}
-	color.Yellow(">> [%s] %s: %s\n", time.Now().Format(time.Kitchen), inMessage.SenderID, inMessage.Message)
+
+	text, _ := getMessageText(inMessage)
+
+	// Unverified messages are shown as they are, since that is the norm for the senders that do not sign.
+	// Forged messages are highlighted, since their claimed sender did not send them.
+	switch inMessage.Verification {
+	case lib.VerificationForged:
+		color.Red(">> [%s] %s (FORGED): %s\n", time.Now().Format(time.Kitchen), inMessage.SenderID, text)
+	case lib.VerificationVerified:
+		color.Yellow(">> [%s] %s (verified): %s\n", time.Now().Format(time.Kitchen), inMessage.SenderID, text)
+	case lib.VerificationUnverified:
+		fallthrough
+	default:
+		color.Yellow(">> [%s] %s: %s\n", time.Now().Format(time.Kitchen), inMessage.SenderID, text)
+	}
+}
+
+// printConnectionEvent prints the provided connection lifecycle event.
+func printConnectionEvent(ctx context.Context, event *lib.ConnectionEvent) {
+	if !printer.isText() {
+		record := newOutputRecord(recordEvent)
+		record.Event, record.Attempt = string(event.Type), event.Attempt
+		if event.Err != nil {
+			record.Error = event.Err.Error()
+		}
+		printer.print(record)
+		return
+	}
+
+	switch event.Type {
+	case lib.EventReconnecting:
+		color.Yellow(">> [%s] Connection lost (%v). Reconnecting in %s, attempt %d...\n",
+			time.Now().Format(time.Kitchen), event.Err, event.Delay.Round(time.Millisecond), event.Attempt)
+	case lib.EventReconnected:
+		color.Green(">> [%s] Reconnected with Rosenbridge.\n", time.Now().Format(time.Kitchen))
+	default:
+	}
+}
+
+// getEndpoint provides the Rosenbridge endpoint as per the backend.url config.
+// It is nil if the config is not set, in which case the deprecated backend.base_url and backend.is_tls_enabled configs
+// are used by the lib. The CLI exits if the config is invalid.
+func getEndpoint() *url.URL {
+	rawURL := viper.GetString("backend.url")
+	if rawURL == "" {
+		return nil
+	}
+
+	endpoint, err := lib.ParseEndpoint(rawURL)
+	if err != nil {
+		exitWithPrintf(exitCodeFailure, "Invalid backend.url config: %s", err.Error())
+	}
+	return endpoint
+}
+
+// resolveClientID provides the given client ID flag value, or the client_id config if the flag isn't provided.
+// The CLI exits if neither of them is provided.
+func resolveClientID(flagValue, flagName string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+
+	clientID := viper.GetString("client_id")
+	if clientID == "" {
+		exitWithPrintf(exitCodeFailure, "required flag \"%s\" not set, and the client_id config is empty", flagName)
+	}
+	return clientID
+}
+
+// getRetryPolicy provides the retry policy for sending messages as per the configs.
+func getRetryPolicy() *lib.RetryPolicy {
+	maxAttempts := viper.GetInt("retry.max_attempts")
+	// The deprecated config is still honoured if the user has set it.
+	if viper.IsSet("general.cold_start_retry_count") {
+		maxAttempts = viper.GetInt("general.cold_start_retry_count")
+	}
+
+	return &lib.RetryPolicy{
+		MaxAttempts:    maxAttempts,
+		InitialBackoff: viper.GetDuration("retry.initial_backoff"),
+		MaxBackoff:     viper.GetDuration("retry.max_backoff"),
+		MaxElapsed:     viper.GetDuration("retry.max_elapsed"),
+	}
+}
+
+// getForwardSecret provides the webhook signing secret from the --forward-secret flag, or from the configs.
+func getForwardSecret() string {
+	if connectForwardSecret != "" {
+		return connectForwardSecret
+	}
+	return viper.GetString("forward.secret")
+}
+
+// getReconnectParams provides the reconnection params as per the configs.
+// It returns nil if reconnection is disabled.
+func getReconnectParams() *lib.ReconnectParams {
+	if !viper.GetBool("backend.reconnect_enabled") {
+		return nil
+	}
+	return &lib.ReconnectParams{MaxAttempts: viper.GetInt("backend.reconnect_max_attempts")}
+}
+
+// printMessageRecord prints the provided incoming message (or error) as an output record.
+func printMessageRecord(inMessage *lib.IncomingMessageReq, err error) {
+	switch {
+	case err != nil:
+		record := newOutputRecord(recordError)
+		record.Error = fmt.Sprintf("error while reading the message: %s", err.Error())
+		printer.print(record)
+	case inMessage == nil:
+		record := newOutputRecord(recordError)
+		record.Error = "message is of unrecognized format"
+		printer.print(record)
+	default:
+		record := newOutputRecord(recordMessage)
+		record.SenderID, record.RequestID = inMessage.SenderID, inMessage.RequestID
+		record.Message, record.Envelope = getMessageText(inMessage)
+		record.Verification = string(inMessage.Verification)
+		printer.print(record)
+	}
+}
+
+// getMessageText provides the text of the given message for display, along with its envelope, if it has one.
+// The body of an envelope is shown rather than the envelope itself. Malformed envelopes are shown as they are.
+func getMessageText(inMessage *lib.IncomingMessageReq) (string, *lib.Envelope) {
+	if !lib.IsEnvelope(inMessage.Message) {
+		return inMessage.Message, nil
+	}
+
+	envelope, err := inMessage.Envelope()
+	if err != nil {
+		return inMessage.Message, nil
+	}
+	return envelope.Text(), envelope
+}
+
+// printDeliveryReport prints the delivery status of the message for each receiver and each of its bridges.
+func printDeliveryReport(request *lib.OutgoingMessageReq, response *lib.OutgoingMessageRes) {
+	if !printer.isText() {
+		record := newOutputRecord(recordDelivery)
+		record.SenderID, record.ReceiverIDs, record.RequestID = request.SenderID, request.ReceiverIDs, request.RequestID
+		record.Message, record.Report = request.Message, response.Report
+		printer.print(record)
+		return
+	}
+
+	for _, receiverID := range request.ReceiverIDs {
+		// The overall status of the receiver decides the color.
+		colorize := color.Red
+		if status := response.ReceiverStatus(receiverID); status == lib.CodeOK {
+			colorize = color.Green
+		}
+		colorize("   %s: %s\n", receiverID, describeDeliveryStatus(response.ReceiverStatus(receiverID)))
+
+		for _, report := range response.Report[receiverID] {
+			// Offline receivers have no bridges, so only the reason is printed for them.
+			if report.BridgeID == "" {
+				if report.Reason != "" {
+					colorize("     - %s\n", report.Reason)
+				}
+				continue
+			}
+
+			line := fmt.Sprintf("bridge %s: %s", report.BridgeID, describeDeliveryStatus(report.Code))
+			if report.Reason != "" {
+				line = fmt.Sprintf("%s (%s)", line, report.Reason)
+			}
+			colorize("     - %s\n", line)
+		}
+	}
+}
+
+// describeDeliveryStatus provides a human-readable description of the given delivery status.
+func describeDeliveryStatus(status lib.DeliveryStatus) string {
+	switch status {
+	case lib.CodeOK:
+		return "delivered"
+	case lib.CodeOffline:
+		return "offline"
+	case lib.CodeBridgeNotFound:
+		return "no bridge"
+	case lib.CodeUnknown:
+		return "failed"
+	default:
+		return fmt.Sprintf("failed with code %s", status)
+	}
+}
+
+// deliveryExitCode provides the exit code as per the delivery status of the message.
+func deliveryExitCode(response *lib.OutgoingMessageRes) int {
+	switch {
+	case !response.Failed():
+		return exitCodeOK
+	case len(response.DeliveredReceivers()) == 0:
+		return exitCodeDeliveryFailed
+	default:
+		return exitCodePartialDelivery
+	}
 }
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/shivanshkc/rosenbridge-cli/lib"
+)
+
+func TestDeliveryExitCode(t *testing.T) {
+	report := map[string][]*lib.DeliveryReport{
+		"bob":   {{BridgeID: "b1", Code: lib.CodeOK}},
+		"carol": {{Code: lib.CodeOffline}},
+	}
+
+	testCases := []struct {
+		name        string
+		receiverIDs []string
+		expected    int
+	}{
+		{name: "delivered", receiverIDs: []string{"bob"}, expected: exitCodeOK},
+		{name: "partially delivered", receiverIDs: []string{"bob", "carol"}, expected: exitCodePartialDelivery},
+		// A receiver absent from the report is printed as failed, so it must not count as delivered.
+		{name: "receiver absent from the report", receiverIDs: []string{"bob", "dave"}, expected: exitCodePartialDelivery},
+		{name: "not delivered", receiverIDs: []string{"carol", "dave"}, expected: exitCodeDeliveryFailed},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			// The report holds only the requested receivers, like the one of Rosenbridge.
+			response := &lib.OutgoingMessageRes{
+				Code: string(lib.CodeOK), Report: map[string][]*lib.DeliveryReport{}, ReceiverIDs: testCase.receiverIDs,
+			}
+			for _, receiverID := range testCase.receiverIDs {
+				if reports, exists := report[receiverID]; exists {
+					response.Report[receiverID] = reports
+				}
+			}
+
+			if code := deliveryExitCode(response); code != testCase.expected {
+				t.Fatalf("expected exit code %d, got %d", testCase.expected, code)
+			}
+		})
+	}
+}
@@ -0,0 +1,17 @@
+package cmd
+
+// Exit codes of the CLI.
+const (
+	// exitCodeOK is used when the command completes successfully.
+	exitCodeOK = 0
+	// exitCodeFailure is used when the command fails due to invalid input or a failed operation.
+	exitCodeFailure = 1
+	// exitCodeConnectionLost is used when an established connection with Rosenbridge breaks unrecoverably.
+	exitCodeConnectionLost = 2
+	// exitCodePartialDelivery is used when a message is delivered to some, but not all, of its receivers.
+	exitCodePartialDelivery = 3
+	// exitCodeDeliveryFailed is used when a message is delivered to none of its receivers.
+	exitCodeDeliveryFailed = 4
+	// exitCodeExecFailed is used when a command executed for an incoming message fails.
+	exitCodeExecFailed = 5
+)
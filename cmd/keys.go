@@ -0,0 +1,195 @@
+package cmd
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/shivanshkc/rosenbridge-cli/lib"
+
+	"github.com/fatih/color"
+	"github.com/spf13/viper"
+)
+
+// errKeyChanged is returned when an imported key differs from the one already in the key store.
+var errKeyChanged = errors.New("differs from the imported one, use --force to replace it")
+
+// keyStore is the local file that holds the key pairs of the clients, and the public keys of the peers.
+type keyStore struct {
+	// KeyPairs maps the client IDs to their key pairs.
+	KeyPairs map[string]*lib.KeyPair `json:"key_pairs"`
+	// Peers holds the public keys of the peers, for encrypting the messages sent to them.
+	Peers *lib.Keyring `json:"peers"`
+	// SigningKeyPairs maps the client IDs to their signing key pairs.
+	SigningKeyPairs map[string]*lib.SigningKeyPair `json:"signing_key_pairs"`
+	// Trusted holds the signing public keys of the peers, for verifying the messages received from them.
+	Trusted *lib.TrustStore `json:"trusted"`
+}
+
+// getKeyStorePath provides the path of the key store as per the keys.file config, whether it exists or not.
+func getKeyStorePath() (string, error) {
+	if path := viper.GetString("keys.file"); path != "" {
+		return path, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".rosen-keys.json"), nil
+}
+
+// readKeyStore reads the key store. A missing file is treated as an empty key store.
+func readKeyStore() (*keyStore, error) {
+	store := &keyStore{
+		KeyPairs:        map[string]*lib.KeyPair{},
+		Peers:           &lib.Keyring{},
+		SigningKeyPairs: map[string]*lib.SigningKeyPair{},
+		Trusted:         &lib.TrustStore{},
+	}
+
+	path, err := getKeyStorePath()
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key store: %w", err)
+	}
+
+	if err := json.Unmarshal(content, store); err != nil {
+		return nil, fmt.Errorf("failed to decode key store %s: %w", path, err)
+	}
+
+	// Sections that are null in the file are treated as empty.
+	if store.KeyPairs == nil {
+		store.KeyPairs = map[string]*lib.KeyPair{}
+	}
+	if store.Peers == nil {
+		store.Peers = &lib.Keyring{}
+	}
+	if store.SigningKeyPairs == nil {
+		store.SigningKeyPairs = map[string]*lib.SigningKeyPair{}
+	}
+	if store.Trusted == nil {
+		store.Trusted = &lib.TrustStore{}
+	}
+	return store, nil
+}
+
+// writeKeyStore writes the given key store. It holds private keys, so a new file is created private.
+func writeKeyStore(store *keyStore) error {
+	path, err := getKeyStorePath()
+	if err != nil {
+		return err
+	}
+
+	content, err := json.MarshalIndent(store, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode key store: %w", err)
+	}
+	return writeFileAtomically(path, append(content, '\n'))
+}
+
+// importPeerKeys adds the given public key, and the optional signing key, of a peer to the key store. It returns the
+// number of keys added.
+//
+// A key that differs from the one already in the store could mean an impersonation attempt, so it is only replaced if
+// force is true. Otherwise, errKeyChanged is returned and the store is left as it was.
+func importPeerKeys(store *keyStore, clientID string, encodedKeys []string, force bool) (int, error) {
+	if err := checkClientID(clientID); err != nil {
+		return 0, fmt.Errorf("invalid client ID %q: %w", clientID, err)
+	}
+	key, err := lib.ParsePublicKey(encodedKeys[0])
+	if err != nil {
+		return 0, fmt.Errorf("invalid public key of %s: %w", clientID, err)
+	}
+
+	// Both keys are checked before any of them is added, so a rejected line leaves nothing behind.
+	existingKey, exists := store.Peers.Get(clientID)
+	keyChanged := exists && existingKey != key
+	if keyChanged && !force {
+		return 0, fmt.Errorf("public key of %s: %w", clientID, errKeyChanged)
+	}
+
+	var signingKey ed25519.PublicKey
+	var signingKeyChanged bool
+	if len(encodedKeys) > 1 {
+		if signingKey, err = lib.ParseSigningPublicKey(encodedKeys[1]); err != nil {
+			return 0, fmt.Errorf("invalid signing key of %s: %w", clientID, err)
+		}
+		existingSigningKey, exists := store.Trusted.Get(clientID)
+		signingKeyChanged = exists && !existingSigningKey.Equal(signingKey)
+		if signingKeyChanged && !force {
+			return 0, fmt.Errorf("signing key of %s: %w", clientID, errKeyChanged)
+		}
+	}
+
+	if keyChanged {
+		color.Yellow("Replacing the public key of %s.\n", clientID)
+	}
+	store.Peers.Add(clientID, key)
+	if signingKey == nil {
+		return 1, nil
+	}
+
+	if signingKeyChanged {
+		color.Yellow("Replacing the signing key of %s.\n", clientID)
+	}
+	store.Trusted.Add(clientID, signingKey)
+	return 2, nil //nolint:gomnd // The public key and the signing key.
+}
+
+// getEncryptionParams provides the encryption params for the given client, using the key store.
+//
+// The key pair of the client is included if it exists, so the encrypted incoming messages can be decrypted. The keyring
+// of the peers is included only if encrypt is true, as that makes all outgoing messages encrypted.
+// The CLI exits if the key store cannot be read, or if encryption is required without a key pair.
+func getEncryptionParams(clientID string, encrypt bool) *lib.EncryptionParams {
+	store, err := readKeyStore()
+	if err != nil {
+		exitWithPrintf(exitCodeFailure, err.Error())
+	}
+
+	params := &lib.EncryptionParams{KeyPair: store.KeyPairs[clientID]}
+	if !encrypt {
+		return params
+	}
+
+	if params.KeyPair == nil {
+		exitWithPrintf(exitCodeFailure, "No key pair found for %s. Use \"rosen keys generate\" to create one.", clientID)
+	}
+	params.Keyring = store.Peers
+	return params
+}
+
+// getSigningParams provides the signing params for the given client, using the key store.
+//
+// The trust store is always included, so the incoming messages are verified. The signing key pair of the client is
+// included only if sign is true, as that makes all outgoing messages signed.
+// The CLI exits if the key store cannot be read, or if signing is required without a signing key pair.
+func getSigningParams(clientID string, sign, dropUnverified bool) *lib.SigningParams {
+	store, err := readKeyStore()
+	if err != nil {
+		exitWithPrintf(exitCodeFailure, err.Error())
+	}
+
+	params := &lib.SigningParams{TrustStore: store.Trusted, DropUnverified: dropUnverified}
+	if !sign {
+		return params
+	}
+
+	params.KeyPair = store.SigningKeyPairs[clientID]
+	if params.KeyPair == nil {
+		exitWithPrintf(exitCodeFailure, "No signing key pair found for %s. Use \"rosen keys generate\" to create one.",
+			clientID)
+	}
+	return params
+}
@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/shivanshkc/rosenbridge-cli/lib"
+)
+
+func TestImportPeerKeys(t *testing.T) {
+	oldKey, oldSigningKey := generatePeerKeys(t)
+	newKey, newSigningKey := generatePeerKeys(t)
+
+	testCases := []struct {
+		name        string
+		encodedKeys []string
+		force       bool
+		expected    []string
+		expectedErr error
+	}{
+		{name: "same keys", encodedKeys: []string{oldKey, oldSigningKey}, expected: []string{oldKey, oldSigningKey}},
+		{
+			name: "changed public key", encodedKeys: []string{newKey, oldSigningKey},
+			expected: []string{oldKey, oldSigningKey}, expectedErr: errKeyChanged,
+		},
+		{
+			name: "changed signing key", encodedKeys: []string{oldKey, newSigningKey},
+			expected: []string{oldKey, oldSigningKey}, expectedErr: errKeyChanged,
+		},
+		{
+			name: "changed public key without a signing key", encodedKeys: []string{newKey},
+			expected: []string{oldKey, oldSigningKey}, expectedErr: errKeyChanged,
+		},
+		{
+			name: "changed keys with force", encodedKeys: []string{newKey, newSigningKey}, force: true,
+			expected: []string{newKey, newSigningKey},
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			store := newTestKeyStore()
+			if _, err := importPeerKeys(store, "bob", []string{oldKey, oldSigningKey}, false); err != nil {
+				t.Fatalf("failed to import the initial keys: %v", err)
+			}
+
+			_, err := importPeerKeys(store, "bob", testCase.encodedKeys, testCase.force)
+			if !errors.Is(err, testCase.expectedErr) {
+				t.Fatalf("expected error %v, got: %v", testCase.expectedErr, err)
+			}
+
+			// A rejected import must leave both keys as they were.
+			key, _ := store.Peers.Get("bob")
+			signingKey, _ := store.Trusted.Get("bob")
+			actual := []string{fmt.Sprint(key), base64.StdEncoding.EncodeToString(signingKey)}
+			if actual[0] != testCase.expected[0] || actual[1] != testCase.expected[1] {
+				t.Fatalf("expected keys %v, got %v", testCase.expected, actual)
+			}
+		})
+	}
+}
+
+func TestImportPeerKeys_Lines(t *testing.T) {
+	oldKey, oldSigningKey := generatePeerKeys(t)
+	newKey, newSigningKey := generatePeerKeys(t)
+
+	store := newTestKeyStore()
+	if _, err := importPeerKeys(store, "bob", []string{oldKey, oldSigningKey}, false); err != nil {
+		t.Fatalf("failed to import the initial keys: %v", err)
+	}
+
+	// A piped line that changes the keys of a trusted peer stops the import.
+	input := fmt.Sprintf("# Peers\ncarol %s\nbob %s %s\n", newKey, newKey, newSigningKey)
+	var count int
+	err := readKeyLines(strings.NewReader(input), func(clientID string, encodedKeys []string) error {
+		imported, err := importPeerKeys(store, clientID, encodedKeys, false)
+		count += imported
+		return err
+	})
+
+	if !errors.Is(err, errKeyChanged) || !strings.HasPrefix(err.Error(), "line 3:") {
+		t.Fatalf("expected errKeyChanged on line 3, got: %v", err)
+	}
+	if count != 1 {
+		t.Fatalf("expected 1 imported key, got %d", count)
+	}
+	if signingKey, _ := store.Trusted.Get("bob"); base64.StdEncoding.EncodeToString(signingKey) != oldSigningKey {
+		t.Fatal("expected the signing key of bob to be kept")
+	}
+}
+
+// newTestKeyStore creates an empty key store.
+func newTestKeyStore() *keyStore {
+	return &keyStore{
+		KeyPairs:        map[string]*lib.KeyPair{},
+		Peers:           &lib.Keyring{},
+		SigningKeyPairs: map[string]*lib.SigningKeyPair{},
+		Trusted:         &lib.TrustStore{},
+	}
+}
+
+// generatePeerKeys provides a new public key and signing key, encoded like "rosen keys export" prints them.
+func generatePeerKeys(t *testing.T) (string, string) {
+	t.Helper()
+
+	keyPair, err := lib.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("failed to generate key pair: %v", err)
+	}
+	signingKeyPair, err := lib.GenerateSigningKeyPair()
+	if err != nil {
+		t.Fatalf("failed to generate signing key pair: %v", err)
+	}
+	return fmt.Sprint(keyPair.PublicKey), base64.StdEncoding.EncodeToString(signingKeyPair.PublicKey)
+}
@@ -0,0 +1,227 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/shivanshkc/rosenbridge-cli/lib"
+
+	"github.com/fatih/color"
+)
+
+// Supported values of the --output flag.
+const (
+	outputText     = "text"
+	outputJSON     = "json"
+	outputNDJSON   = "ndjson"
+	outputLogfmt   = "logfmt"
+	outputTemplate = "template"
+)
+
+// Types of output records.
+const (
+	recordMessage  = "message"
+	recordDelivery = "delivery"
+	recordEvent    = "event"
+	recordError    = "error"
+)
+
+// outputFlagUsage is the usage of the --output flag, shared by all commands that support it.
+const outputFlagUsage = `Output format. One of: text, json, ndjson, logfmt, template=<go-template>.
+The template is executed against each record, for example: template='{{.SenderID}}: {{.Message}}'.`
+
+// outputFormat binds with the --output flag of the commands.
+var outputFormat string
+
+// printer is the output printer of the current command. It defaults to the human-readable text format.
+var printer = &outputPrinter{format: outputText, writer: os.Stdout, mutex: &sync.Mutex{}}
+
+// outputRecord is the unit of machine-readable output.
+type outputRecord struct {
+	// Type tells what this record represents, like a message or a delivery report.
+	Type string `json:"type"`
+	// Timestamp is the RFC3339 time at which the record was created.
+	Timestamp string `json:"timestamp"`
+	// SenderID is the ID of the client who sent the message.
+	SenderID string `json:"sender_id,omitempty"`
+	// ReceiverIDs are the IDs of the clients to whom the message was sent.
+	ReceiverIDs []string `json:"receiver_ids,omitempty"`
+	// RequestID is the ID of the request that carried the message.
+	RequestID string `json:"request_id,omitempty"`
+	// Message is the message body.
+	Message string `json:"message,omitempty"`
+	// Verification tells if the incoming message is proven to come from its sender.
+	Verification string `json:"verification,omitempty"`
+	// Envelope is the envelope of the incoming message, if it has one. The Message is the text of its body then.
+	Envelope *lib.Envelope `json:"envelope,omitempty"`
+	// Report is the delivery report of a sent message, keyed by the receiver IDs.
+	Report map[string][]*lib.DeliveryReport `json:"report,omitempty"`
+	// Event is the type of the connection lifecycle event.
+	Event string `json:"event,omitempty"`
+	// Attempt is the reconnection attempt that the event belongs to.
+	Attempt int `json:"attempt,omitempty"`
+	// Error describes the failure, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// outputPrinter writes the output records in the configured format.
+type outputPrinter struct {
+	// format is one of the supported output formats.
+	format string
+	// tmpl is the parsed template for the template format.
+	tmpl *template.Template
+	// writer is where the records are written.
+	writer io.Writer
+	// mutex serializes the writes, since handlers may print concurrently.
+	mutex *sync.Mutex
+}
+
+// setupOutput configures the printer as per the --output flag.
+//
+// For the machine-readable formats, all human-oriented status lines are moved to stderr and colors are disabled, so
+// that stdout only contains the records. Colors are also disabled automatically when stdout isn't a terminal.
+func setupOutput() error {
+	format, tmplText := outputFormat, ""
+	if strings.HasPrefix(outputFormat, outputTemplate+"=") {
+		format, tmplText = outputTemplate, strings.TrimPrefix(outputFormat, outputTemplate+"=")
+	}
+
+	newPrinter := &outputPrinter{format: format, writer: os.Stdout, mutex: &sync.Mutex{}}
+	switch format {
+	case outputText:
+	case outputJSON, outputNDJSON, outputLogfmt:
+	case outputTemplate:
+		// Each record is printed on its own line.
+		if !strings.HasSuffix(tmplText, "\n") {
+			tmplText += "\n"
+		}
+
+		tmpl, err := template.New("output").Parse(tmplText)
+		if err != nil {
+			return fmt.Errorf("invalid output template: %w", err)
+		}
+		newPrinter.tmpl = tmpl
+	default:
+		return fmt.Errorf("unknown output format %q, use one of: text, json, ndjson, logfmt, template=<go-template>",
+			outputFormat)
+	}
+
+	if format != outputText {
+		color.Output, color.NoColor = os.Stderr, true
+	}
+
+	printer = newPrinter
+	return nil
+}
+
+// isText tells if the printer emits human-readable text.
+func (p *outputPrinter) isText() bool {
+	return p.format == outputText
+}
+
+// print writes the given record in the configured format.
+func (p *outputPrinter) print(record *outputRecord) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	var err error
+	switch p.format {
+	case outputJSON:
+		encoder := json.NewEncoder(p.writer)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(record)
+	case outputNDJSON:
+		err = json.NewEncoder(p.writer).Encode(record)
+	case outputLogfmt:
+		_, err = io.WriteString(p.writer, formatLogfmt(record))
+	case outputTemplate:
+		err = p.tmpl.Execute(p.writer, record)
+	default:
+	}
+
+	if err != nil {
+		color.Red("Failed to print output: %s\n", err.Error())
+	}
+}
+
+// newOutputRecord creates a new output record of the given type, timestamped with the current time.
+func newOutputRecord(recordType string) *outputRecord {
+	return &outputRecord{Type: recordType, Timestamp: time.Now().Format(time.RFC3339)}
+}
+
+// formatLogfmt formats the given record as logfmt lines.
+//
+// Since logfmt is flat, a record with a delivery report produces one line per receiver bridge.
+func formatLogfmt(record *outputRecord) string {
+	common := []string{
+		"time=" + logfmtValue(record.Timestamp),
+		"type=" + logfmtValue(record.Type),
+	}
+
+	// Adding the optional fields only if they are present.
+	optional := []struct{ key, value string }{
+		{"sender_id", record.SenderID},
+		{"receiver_ids", strings.Join(record.ReceiverIDs, ",")},
+		{"request_id", record.RequestID},
+		{"message", record.Message},
+		{"verification", record.Verification},
+		{"event", record.Event},
+		{"error", record.Error},
+	}
+	if record.Attempt > 0 {
+		optional = append(optional, struct{ key, value string }{"attempt", strconv.Itoa(record.Attempt)})
+	}
+	if record.Envelope != nil {
+		optional = append(optional, []struct{ key, value string }{
+			{"message_id", record.Envelope.MessageID},
+			{"correlation_id", record.Envelope.CorrelationID},
+			{"content_type", record.Envelope.ContentType},
+		}...)
+	}
+	for _, field := range optional {
+		if field.value != "" {
+			common = append(common, field.key+"="+logfmtValue(field.value))
+		}
+	}
+
+	if len(record.Report) == 0 {
+		return strings.Join(common, " ") + "\n"
+	}
+
+	// Sorting the receivers for a stable output.
+	receiverIDs := make([]string, 0, len(record.Report))
+	for receiverID := range record.Report {
+		receiverIDs = append(receiverIDs, receiverID)
+	}
+	sort.Strings(receiverIDs)
+
+	builder := &strings.Builder{}
+	for _, receiverID := range receiverIDs {
+		for _, report := range record.Report[receiverID] {
+			line := append(append([]string(nil), common...),
+				"receiver_id="+logfmtValue(receiverID),
+				"bridge_id="+logfmtValue(report.BridgeID),
+				"code="+logfmtValue(string(report.Code)),
+				"reason="+logfmtValue(report.Reason),
+			)
+			builder.WriteString(strings.Join(line, " ") + "\n")
+		}
+	}
+	return builder.String()
+}
+
+// logfmtValue quotes the given logfmt value if required.
+func logfmtValue(value string) string {
+	if value == "" || strings.ContainsAny(value, " =\"\t\n\r") {
+		return strconv.Quote(value)
+	}
+	return value
+}
@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"unicode/utf8"
+
+	"github.com/shivanshkc/rosenbridge-cli/lib"
+
+	"github.com/fatih/color"
+	"github.com/google/uuid"
+)
+
+// Special values of the --split flag.
+const (
+	splitNewline = "newline"
+	splitNUL     = "nul"
+	splitNone    = "none"
+)
+
+// maxPipedMessageSize is the maximum size of a single message read from a pipe.
+const maxPipedMessageSize = 16 * 1024 * 1024
+
+// isStdinPipe tells if the stdin is a pipe or a file, rather than a terminal.
+func isStdinPipe() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice == 0
+}
+
+// sendFromPipe sends the messages read from the given reader until EOF, and provides the exit code.
+//
+// The exit code is that of the worst delivery, so it is exitCodeOK only if every message reached all its receivers.
+// A message that cannot be sent, including the one that is not valid UTF-8, stops the sending with exitCodeFailure.
+// The split param decides how the input is broken into messages. See the --split flag for the possible values.
+func sendFromPipe(reader io.Reader, split string, receiverIDs []string, params *lib.ConnectionParams) int {
+	// The whole input is a single message.
+	if split == splitNone {
+		message, err := io.ReadAll(reader)
+		if err != nil {
+			exitWithPrintf(exitCodeFailure, "failed to read stdin: %s", err.Error())
+		}
+		if len(message) == 0 {
+			return exitCodeOK
+		}
+		return sendPipedMessage(string(message), receiverIDs, params)
+	}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxPipedMessageSize)
+	scanner.Split(splitOnDelimiter(getDelimiter(split)))
+
+	exitCode := exitCodeOK
+	for scanner.Scan() {
+		message := scanner.Text()
+		// Removing the carriage returns of CRLF line endings.
+		if split == splitNewline {
+			message = string(bytes.TrimSuffix(scanner.Bytes(), []byte("\r")))
+		}
+		// Empty messages are not sent, so blank lines and trailing delimiters are harmless.
+		if message == "" {
+			continue
+		}
+
+		code := sendPipedMessage(message, receiverIDs, params)
+		if code == exitCodeFailure {
+			return code
+		}
+		// Among the delivery exit codes, the greater one means the worse delivery.
+		if code > exitCode {
+			exitCode = code
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		exitWithPrintf(exitCodeFailure, "failed to read stdin: %s", err.Error())
+	}
+
+	// EOF is the normal end of the input.
+	return exitCode
+}
+
+// sendPipedMessage sends a single message read from a pipe and prints its delivery report.
+// It provides the exit code as per the delivery.
+//
+// Messages travel as JSON strings, which would silently replace the invalid UTF-8 sequences, so the binary messages are
+// rejected with exitCodeFailure instead.
+func sendPipedMessage(message string, receiverIDs []string, params *lib.ConnectionParams) int {
+	if !utf8.ValidString(message) {
+		color.Red("The piped message is not valid UTF-8 text. Binary input should be encoded, for example with base64.\n")
+		return exitCodeFailure
+	}
+
+	outgoingMessage := &lib.OutgoingMessageReq{
+		RequestID:   uuid.NewString(),
+		ReceiverIDs: receiverIDs,
+		Message:     message,
+		SenderID:    params.ClientID,
+	}
+
+	response, err := sendMessageWithRetries(outgoingMessage, params)
+	if err != nil {
+		return exitCodeFailure
+	}
+
+	printDeliveryReport(outgoingMessage, response)
+	return deliveryExitCode(response)
+}
+
+// getDelimiter converts the value of the --split flag to the delimiter bytes.
+func getDelimiter(split string) []byte {
+	switch split {
+	case splitNewline:
+		return []byte("\n")
+	case splitNUL:
+		return []byte{0}
+	default:
+		return []byte(split)
+	}
+}
+
+// splitOnDelimiter provides a bufio.SplitFunc that splits the input on the given delimiter.
+// The content after the last delimiter is provided as the final token.
+func splitOnDelimiter(delimiter []byte) bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		if atEOF && len(data) == 0 {
+			return 0, nil, nil
+		}
+
+		if index := bytes.Index(data, delimiter); index >= 0 {
+			return index + len(delimiter), data[:index], nil
+		}
+
+		// The remaining data is the last token.
+		if atEOF {
+			return len(data), data, nil
+		}
+
+		// Requesting more data.
+		return 0, nil, nil
+	}
+}
+
+// validateSplit checks if the given value of the --split flag is usable.
+func validateSplit(split string) error {
+	if split == "" {
+		return fmt.Errorf("split cannot be empty, use %q to send the whole input as one message", splitNone)
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shivanshkc/rosenbridge-cli/lib"
+	"github.com/shivanshkc/rosenbridge-cli/lib/rosentest"
+)
+
+// hookReader calls its hook once, before the first read.
+type hookReader struct {
+	hook   func()
+	reader io.Reader
+	once   sync.Once
+}
+
+// Read implements io.Reader.
+func (h *hookReader) Read(p []byte) (int, error) {
+	h.once.Do(h.hook)
+	return h.reader.Read(p)
+}
+
+func TestSendFromPipe_ExitCode(t *testing.T) {
+	testCases := []struct {
+		name        string
+		online      []string
+		receiverIDs []string
+		expected    int
+	}{
+		{name: "delivered to all", online: []string{"bob", "carol"}, receiverIDs: []string{"bob", "carol"}},
+		{
+			name: "delivered to some", online: []string{"bob"}, receiverIDs: []string{"bob", "carol"},
+			expected: exitCodePartialDelivery,
+		},
+		{name: "delivered to none", receiverIDs: []string{"bob"}, expected: exitCodeDeliveryFailed},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			server := rosentest.NewServer()
+			defer server.Close()
+
+			for _, clientID := range testCase.online {
+				connectClient(t, server, clientID)
+			}
+
+			code := sendFromPipe(strings.NewReader("one\ntwo\n"), splitNewline, testCase.receiverIDs,
+				server.ConnectionParams("alice"))
+			if code != testCase.expected {
+				t.Fatalf("expected exit code %d, got %d", testCase.expected, code)
+			}
+		})
+	}
+}
+
+func TestSendFromPipe_WorstExitCodeKept(t *testing.T) {
+	server := rosentest.NewServer()
+	defer server.Close()
+
+	// Bob comes online only after the first message, so only the second one is delivered.
+	reader := io.MultiReader(
+		strings.NewReader("one\n"),
+		&hookReader{hook: func() { connectClient(t, server, "bob") }, reader: strings.NewReader("two\n")},
+	)
+
+	code := sendFromPipe(reader, splitNewline, []string{"bob"}, server.ConnectionParams("alice"))
+	if code != exitCodeDeliveryFailed {
+		t.Fatalf("expected exit code %d, got %d", exitCodeDeliveryFailed, code)
+	}
+	if routed := server.RoutedMessages(); len(routed) != 2 {
+		t.Fatalf("expected 2 routed messages, got %d", len(routed))
+	}
+}
+
+func TestSendFromPipe_SendFailure(t *testing.T) {
+	server := rosentest.NewServer()
+	defer server.Close()
+
+	// A failure that is not retried stops the sending altogether.
+	server.FailNextRequests(1, http.StatusBadRequest)
+	code := sendFromPipe(strings.NewReader("one\ntwo\n"), splitNewline, []string{"bob"},
+		server.ConnectionParams("alice"))
+	if code != exitCodeFailure {
+		t.Fatalf("expected exit code %d, got %d", exitCodeFailure, code)
+	}
+	if routed := server.RoutedMessages(); len(routed) != 0 {
+		t.Fatalf("expected no routed messages, got %d", len(routed))
+	}
+}
+
+func TestSendFromPipe_InvalidUTF8(t *testing.T) {
+	testCases := []struct {
+		name   string
+		input  string
+		split  string
+		routed int
+	}{
+		{name: "whole input", input: "binary \xff\xfe data", split: splitNone},
+		{name: "second line", input: "text\nbinary \xff\nmore text\n", split: splitNewline, routed: 1},
+		{name: "split inside a rune", input: "caf\xc3|\xa9", split: "|"},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			server := rosentest.NewServer()
+			defer server.Close()
+
+			connectClient(t, server, "bob")
+
+			// The invalid message is not sent at all, and stops the sending.
+			code := sendFromPipe(strings.NewReader(testCase.input), testCase.split, []string{"bob"},
+				server.ConnectionParams("alice"))
+			if code != exitCodeFailure {
+				t.Fatalf("expected exit code %d, got %d", exitCodeFailure, code)
+			}
+			if routed := server.RoutedMessages(); len(routed) != testCase.routed {
+				t.Fatalf("expected %d routed messages, got %d", testCase.routed, len(routed))
+			}
+		})
+	}
+
+	// Multi-byte text passes unchanged.
+	server := rosentest.NewServer()
+	defer server.Close()
+
+	connectClient(t, server, "bob")
+	code := sendFromPipe(strings.NewReader("héllo wörld ✓"), splitNone, []string{"bob"},
+		server.ConnectionParams("alice"))
+	if code != exitCodeOK {
+		t.Fatalf("expected exit code %d, got %d", exitCodeOK, code)
+	}
+	if routed := server.RoutedMessages(); len(routed) != 1 || routed[0].Message != "héllo wörld ✓" {
+		t.Fatalf("expected the message to be routed unchanged, got: %+v", routed)
+	}
+}
+
+// connectClient connects the given client to the server, and waits until the server registers its bridge.
+// The connection is closed when the test ends.
+func connectClient(t *testing.T, server *rosentest.Server, clientID string) {
+	t.Helper()
+
+	// The server is closed before the connection, so the closure error is expected.
+	conn, err := lib.NewConnection(context.Background(), server.ConnectionParams(clientID),
+		lib.WithConnectionClosureHandler(func(ctx context.Context, err interface{}) {}))
+	if err != nil {
+		t.Fatalf("failed to connect %s: %v", clientID, err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	deadline := time.Now().Add(5 * time.Second) //nolint:gomnd // Generous for a local server.
+	for server.BridgeCount(clientID) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("bridge of %s not registered", clientID)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/spf13/viper"
+)
+
+// Config keys and env vars of the profiles.
+const (
+	// profilesKey is the config key under which the named profiles are defined.
+	profilesKey = "profiles"
+	// currentProfileKey is the config key of the profile that is used by default.
+	currentProfileKey = "current_profile"
+	// profileEnvVar is the env var that selects the profile. The --profile flag takes precedence over it.
+	profileEnvVar = "ROSEN_PROFILE"
+)
+
+// profileName binds with the --profile flag of the root command.
+var profileName string
+
+// profileErr is the error that occurred while applying the selected profile, if any.
+var profileErr error
+
+// activeProfile is the name of the profile in use. It is empty if no profile is in use.
+var activeProfile string
+
+// applyProfile overlays the values of the selected profile over the top-level values of the config file.
+//
+// The profile is selected by the --profile flag, the ROSEN_PROFILE env var, or the current_profile config, in that
+// order. It is an error if the flag or the env var name a profile that does not exist.
+func applyProfile() error {
+	name, isExplicit := profileName, true
+	if name == "" {
+		name = os.Getenv(profileEnvVar)
+	}
+	if name == "" {
+		name, isExplicit = viper.GetString(currentProfileKey), false
+	}
+
+	// No profile is in use, so the top-level values are used as they are.
+	if name == "" {
+		return nil
+	}
+
+	if !viper.IsSet(profilesKey + "." + name) {
+		if isExplicit {
+			return fmt.Errorf("profile %q does not exist in the config file", name)
+		}
+		// The current profile may have been removed from the file. It must not lock the user out of the CLI.
+		_, _ = fmt.Fprintf(os.Stderr, "Current profile %q does not exist, ignoring it.\n", name)
+		return nil
+	}
+
+	if err := viper.MergeConfigMap(viper.GetStringMap(profilesKey + "." + name)); err != nil {
+		return fmt.Errorf("failed to apply profile %q: %w", name, err)
+	}
+
+	activeProfile = name
+	return nil
+}
+
+// getProfileNames provides the sorted names of all profiles in the config.
+func getProfileNames() []string {
+	profiles := viper.GetStringMap(profilesKey)
+
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
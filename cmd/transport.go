@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/spf13/viper"
+)
+
+// proxyNone is the value of the proxy.url config that disables the proxies, including the ones of the env vars.
+const proxyNone = "none"
+
+// getTLSConfig provides the TLS config as per the tls configs. It is nil if none of them are set.
+// The CLI exits if the configs are invalid.
+func getTLSConfig() *tls.Config {
+	caFile := viper.GetString("tls.ca_file")
+	certFile, keyFile := viper.GetString("tls.cert_file"), viper.GetString("tls.key_file")
+	serverName := viper.GetString("tls.server_name")
+	insecure := viper.GetBool("tls.insecure_skip_verify")
+
+	if caFile == "" && certFile == "" && keyFile == "" && serverName == "" && !insecure {
+		return nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         serverName,
+		InsecureSkipVerify: insecure, //nolint:gosec // The user asked for it explicitly.
+	}
+
+	if insecure {
+		_, _ = fmt.Fprintln(os.Stderr, "Warning: TLS certificate verification is disabled.")
+	}
+
+	// The CA bundle is added to the system CAs, so the public endpoints keep working.
+	if caFile != "" {
+		pool, err := loadCertPool(caFile)
+		if err != nil {
+			exitWithPrintf(exitCodeFailure, err.Error())
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	// The client certificate for mTLS.
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			exitWithPrintf(exitCodeFailure, "Both the client certificate and its key are required for mTLS.")
+		}
+		certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			exitWithPrintf(exitCodeFailure, "Failed to load client certificate: %s", err.Error())
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	return tlsConfig
+}
+
+// loadCertPool provides the system cert pool along with the PEM certificates of the given file.
+func loadCertPool(caFile string) (*x509.CertPool, error) {
+	content, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ca file: %w", err)
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+
+	if !pool.AppendCertsFromPEM(content) {
+		return nil, errors.New("ca file has no valid PEM certificates")
+	}
+	return pool, nil
+}
+
+// getProxy provides the proxy func as per the proxy.url config.
+// It is nil if the config is not set, in which case the proxy env vars are honoured.
+func getProxy() func(*http.Request) (*url.URL, error) {
+	rawURL := viper.GetString("proxy.url")
+	switch rawURL {
+	case "":
+		return nil
+	case proxyNone:
+		return func(*http.Request) (*url.URL, error) { return nil, nil }
+	}
+
+	proxyURL, err := url.Parse(rawURL)
+	if err != nil {
+		exitWithPrintf(exitCodeFailure, "Invalid proxy.url config: %s", err.Error())
+	}
+
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5":
+	default:
+		exitWithPrintf(exitCodeFailure, "Invalid proxy.url config: scheme must be one of http, https or socks5")
+	}
+	return http.ProxyURL(proxyURL)
+}
@@ -0,0 +1,73 @@
+package lib
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Authenticate calls f(ctx, header).
+func (f AuthenticatorFunc) Authenticate(ctx context.Context, header http.Header) error {
+	return f(ctx, header)
+}
+
+// Token calls f(ctx).
+func (f TokenSourceFunc) Token(ctx context.Context) (string, error) {
+	return f(ctx)
+}
+
+// BearerTokenAuth provides an Authenticator that sends the given static token in the "Authorization: Bearer" header.
+func BearerTokenAuth(token string) Authenticator {
+	return AuthenticatorFunc(func(ctx context.Context, header http.Header) error {
+		header.Set("Authorization", "Bearer "+token)
+		return nil
+	})
+}
+
+// APIKeyAuth provides an Authenticator that sends the given API key in the given header, like "X-API-Key".
+func APIKeyAuth(headerName, key string) Authenticator {
+	return AuthenticatorFunc(func(ctx context.Context, header http.Header) error {
+		header.Set(headerName, key)
+		return nil
+	})
+}
+
+// BasicAuth provides an Authenticator that sends the given credentials in the "Authorization: Basic" header.
+func BasicAuth(username, password string) Authenticator {
+	encoded := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+	return AuthenticatorFunc(func(ctx context.Context, header http.Header) error {
+		header.Set("Authorization", "Basic "+encoded)
+		return nil
+	})
+}
+
+// TokenSourceAuth provides an Authenticator that sends the tokens of the given source in the "Authorization: Bearer"
+// header. The source is asked for a token upon every request and every (re)connection, so it can refresh the tokens
+// as required. Caching the tokens, if desired, is up to the source.
+func TokenSourceAuth(source TokenSource) Authenticator {
+	return AuthenticatorFunc(func(ctx context.Context, header http.Header) error {
+		token, err := source.Token(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get token: %w", err)
+		}
+		if token == "" {
+			return errors.New("token source provided an empty token")
+		}
+
+		header.Set("Authorization", "Bearer "+token)
+		return nil
+	})
+}
+
+// authenticate adds the credentials of the connection params (if any) to the given header.
+func authenticate(ctx context.Context, params *ConnectionParams, header http.Header) error {
+	if params.Auth == nil {
+		return nil
+	}
+	if err := params.Auth.Authenticate(ctx, header); err != nil {
+		return fmt.Errorf("failed to authenticate: %w", err)
+	}
+	return nil
+}
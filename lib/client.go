@@ -0,0 +1,115 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Client is a reusable client of a Rosenbridge deployment.
+//
+// Unlike the package level SendMessage function, it builds its HTTP client and websocket dialer only once, so the
+// connections (and TLS sessions) are pooled across all the messages. It is safe for concurrent use.
+type Client struct {
+	// params are the defaults of all operations, with the HTTPClient and Dialer always set.
+	params *ConnectionParams
+}
+
+// NewClient creates a new client as per the given params.
+//
+// The params are copied, so later changes to them do not affect the client. If the HTTPClient or Dialer params are
+// nil, they are created once here, as per the TLSConfig, Proxy and DialTimeout params. The created HTTP client has a
+// transport of its own, which is not shared with http.DefaultClient.
+func NewClient(params *ConnectionParams) (*Client, error) {
+	// Failing early upon an unusable endpoint.
+	if _, err := getBaseEndpoint(params); err != nil {
+		return nil, err
+	}
+
+	paramsCopy := *params
+	paramsCopy.Dialer = getDialer(params)
+	// The client always gets a transport of its own, even with the default params, so closing its idle connections
+	// does not affect the rest of the process.
+	if paramsCopy.HTTPClient == nil {
+		paramsCopy.HTTPClient = &http.Client{Transport: newTransport(params)}
+	}
+
+	return &Client{params: &paramsCopy}, nil
+}
+
+// Send sends a new message synchronously, on behalf of the ClientID of the params.
+//
+// If the Retry param is set, failed attempts are retried as per the policy. If the Signing and Encryption params
+// require it, the message is signed and encrypted for its receivers, without modifying the given request.
+func (c *Client) Send(ctx context.Context, request *OutgoingMessageReq) (*OutgoingMessageRes, error) {
+	// Signing and encrypting only once, so the retries do not wrap the message again.
+	request, err := prepareRequest(request, c.params)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.params.Retry == nil {
+		return sendMessageOnce(ctx, request, c.params)
+	}
+
+	var outMessageRes *OutgoingMessageRes
+	err = c.params.Retry.Do(ctx, func(ctx context.Context) error {
+		var err error
+		outMessageRes, err = sendMessageOnce(ctx, request, c.params)
+		return err
+	})
+
+	return outMessageRes, err
+}
+
+// Connect creates a new connection for the ClientID of the params, using the dialer of the client.
+// See NewConnection for the details.
+func (c *Client) Connect(ctx context.Context, opts ...ConnectionOption) (*Connection, error) {
+	// Every connection gets its own copy of the params, as it keeps them for reconnections.
+	paramsCopy := *c.params
+	return NewConnection(ctx, &paramsCopy, opts...)
+}
+
+// Ping checks if the deployment is healthy, and provides the round-trip time of the check.
+//
+// It makes a GET request to the api path of the endpoint, with the credentials. The deployment is healthy only if it
+// responds with a 2xx status code. Otherwise, a *StatusError is returned, which carries the status code and matches
+// ErrUnauthorized for 401 and 403. A 404 usually means that the path prefix of the endpoint is wrong.
+func (c *Client) Ping(ctx context.Context) (time.Duration, error) {
+	endpoint, err := getHTTPEndpoint(c.params, "api")
+	if err != nil {
+		return 0, err
+	}
+
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint.String(), nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to form the http request: %w", err)
+	}
+	if err := authenticate(ctx, c.params, httpRequest.Header); err != nil {
+		return 0, err
+	}
+
+	start := time.Now()
+	response, err := c.params.HTTPClient.Do(httpRequest)
+	if err != nil {
+		return 0, fmt.Errorf("failed to execute http request: %w", err)
+	}
+	elapsed := time.Since(start)
+
+	// Draining the body, so the connection can be reused.
+	body, _ := anyToBytes(response.Body)
+	_ = response.Body.Close()
+
+	if !isCode2xx(response.StatusCode) {
+		return 0, &StatusError{StatusCode: response.StatusCode, Body: strings.TrimSpace(string(body))}
+	}
+	return elapsed, nil
+}
+
+// CloseIdleConnections closes the idle connections of the HTTP client, without affecting the ones in use.
+// If the HTTPClient param was provided, the idle connections of its transport are closed, whoever else uses it.
+func (c *Client) CloseIdleConnections() {
+	c.params.HTTPClient.CloseIdleConnections()
+}
@@ -0,0 +1,146 @@
+package lib_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shivanshkc/rosenbridge-cli/lib"
+	"github.com/shivanshkc/rosenbridge-cli/lib/rosentest"
+)
+
+func TestClient_Ping(t *testing.T) {
+	server := rosentest.NewServer()
+	defer server.Close()
+
+	client, err := lib.NewClient(server.ConnectionParams("alice"))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	if _, err := client.Ping(context.Background()); err != nil {
+		t.Fatalf("expected the server to be healthy, got: %v", err)
+	}
+
+	// A wrong path prefix must not pass for a healthy deployment.
+	params := server.ConnectionParams("alice")
+	params.Endpoint.Path = "/wrong/prefix/"
+	client, err = lib.NewClient(params)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	var statusErr *lib.StatusError
+	if _, err := client.Ping(context.Background()); !errors.As(err, &statusErr) ||
+		statusErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected a StatusError with status 404, got: %v", err)
+	}
+
+	// Rejected credentials are reported as such.
+	server.RequireBearerToken("secret")
+	client, err = lib.NewClient(server.ConnectionParams("alice"))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	if _, err := client.Ping(context.Background()); !errors.Is(err, lib.ErrUnauthorized) {
+		t.Fatalf("expected ErrUnauthorized, got: %v", err)
+	}
+}
+
+func TestClient_CloseIdleConnections(t *testing.T) {
+	// The server keeps track of the connections that the clients close.
+	var mutex sync.Mutex
+	opened, closed := 0, 0
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		switch state { //nolint:exhaustive // Only the opening and closing matter.
+		case http.StateNew:
+			opened++
+		case http.StateClosed:
+			closed++
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	counts := func() (int, int) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return opened, closed
+	}
+
+	// Some other code of the process uses the default client.
+	response, err := http.Get(server.URL) //nolint:noctx // A plain request of another package.
+	if err != nil {
+		t.Fatalf("failed to make request: %v", err)
+	}
+	_ = response.Body.Close()
+
+	endpoint, err := lib.ParseEndpoint(server.URL)
+	if err != nil {
+		t.Fatalf("failed to parse endpoint: %v", err)
+	}
+	client, err := lib.NewClient(&lib.ConnectionParams{ClientID: "alice", Endpoint: endpoint})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	if _, err := client.Ping(context.Background()); err != nil {
+		t.Fatalf("failed to ping: %v", err)
+	}
+
+	// The client does not reuse the connection of the default client, and closes only its own.
+	client.CloseIdleConnections()
+	deadline := time.Now().Add(testTimeout)
+	for _, closedCount := counts(); closedCount == 0; _, closedCount = counts() {
+		if time.Now().After(deadline) {
+			t.Fatal("idle connection of the client not closed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if openedCount, closedCount := counts(); openedCount != 2 || closedCount != 1 {
+		t.Fatalf("expected 2 opened and 1 closed connections, got %d and %d", openedCount, closedCount)
+	}
+}
+
+func BenchmarkClientSend(b *testing.B) {
+	server := rosentest.NewTLSServer()
+	defer server.Close()
+
+	client, err := lib.NewClient(server.ConnectionParams("alice"))
+	if err != nil {
+		b.Fatalf("failed to create client: %v", err)
+	}
+	defer client.CloseIdleConnections()
+
+	request := &lib.OutgoingMessageReq{Message: "hello", ReceiverIDs: []string{"bob"}}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := client.Send(context.Background(), request); err != nil {
+			b.Fatalf("failed to send message: %v", err)
+		}
+	}
+}
+
+func BenchmarkSendMessage(b *testing.B) {
+	server := rosentest.NewTLSServer()
+	defer server.Close()
+
+	params := server.ConnectionParams("alice")
+	request := &lib.OutgoingMessageReq{Message: "hello", ReceiverIDs: []string{"bob"}}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := lib.SendMessage(context.Background(), request, params); err != nil {
+			b.Fatalf("failed to send message: %v", err)
+		}
+	}
+}
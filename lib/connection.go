@@ -7,57 +7,144 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
 // Connection represents a connection with Rosenbridge.
 type Connection struct {
 	// underlyingConn is the low-level connection object.
+	// It is replaced with a new one whenever the connection is re-established.
 	underlyingConn *websocket.Conn
 	// connectionParams are the parameters required to create the connection.
 	connectionParams *ConnectionParams
 
+	// isClosed is set when the connection is closed by the user, so it is not re-established.
+	isClosed bool
+	// closeReason is the reason provided while closing the connection. It is nil if Close was called.
+	closeReason error
+	// connMutex guards the underlyingConn, isClosed and closeReason fields.
+	connMutex *sync.RWMutex
+
+	// outboundQueue holds the frames waiting to be written by the writer goroutine.
+	outboundQueue chan *outboundFrame
+	// writerDoneChan is closed when the writer goroutine exits.
+	writerDoneChan chan struct{}
+
+	// closedChan is closed as soon as the connection closure is initiated.
+	closedChan chan struct{}
+	// doneChan is closed after the connection is fully closed and the closure handler has returned.
+	doneChan chan struct{}
+	// closureErr is the final reason of the connection closure.
+	closureErr interface{}
+
+	// pendingResponses maps the request IDs of the in-flight synchronous requests to their response channels.
+	pendingResponses map[string]chan *pendingResponse
+	// pendingMutex guards the pendingResponses map.
+	pendingMutex *sync.Mutex
+
+	// messagesChan, if not nil, receives all incoming messages.
+	messagesChan chan *IncomingEvent
+	// messagesPolicy decides what happens when the messagesChan is full.
+	messagesPolicy OverflowPolicy
+	// responsesChan, if not nil, receives all outgoing message responses.
+	responsesChan chan *ResponseEvent
+	// responsesPolicy decides what happens when the responsesChan is full.
+	responsesPolicy OverflowPolicy
+
 	// IncomingMessageHandler handles incoming message.
+	//
+	// Assigning the handlers after NewConnection returns races with the reader, so the options should be preferred.
 	IncomingMessageHandler IncomingMessageHandlerFunc
 	// OutgoingMessageResponseHandler handles outgoing message responses.
 	OutgoingMessageResponseHandler OutgoingMessageResponseHandlerFunc
 	// ConnectionClosureHandler handles connection closures.
 	ConnectionClosureHandler ConnectionClosureHandlerFunc
+	// ConnectionEventHandler handles connection lifecycle events, like reconnections.
+	ConnectionEventHandler ConnectionEventHandlerFunc
 }
 
 // NewConnection creates and returns a new connection.
-func NewConnection(ctx context.Context, params *ConnectionParams) (*Connection, error) {
-	// Deciding on the protocol.
-	wsProtocol := getWebsocketProtocol(params)
-	// Forming the API endpoint URL.
-	endpoint := fmt.Sprintf("%s://%s/api/bridge?client_id=%s", wsProtocol, params.BaseURL, params.ClientID)
-
+//
+// If params.Reconnect is set, the connection is transparently re-established whenever it breaks, and the handlers
+// continue to be used for the new bridge.
+//
+// The connection is gracefully closed when the provided context is cancelled.
+//
+// Handlers and event channels can be configured using the options.
+func NewConnection(ctx context.Context, params *ConnectionParams, opts ...ConnectionOption) (*Connection, error) {
 	// Establishing websocket connection.
-	underlyingConn, response, err := websocket.DefaultDialer.Dial(endpoint, nil)
+	underlyingConn, err := dialBridge(ctx, params)
 	if err != nil {
-		return nil, fmt.Errorf("error in websocket.Dial: %w", err)
+		return nil, err
+	}
+
+	sendQueueSize := params.SendQueueSize
+	if sendQueueSize <= 0 {
+		sendQueueSize = defaultSendQueueSize
 	}
-	defer func() { _ = response.Body.Close() }()
 
 	// Creating the connection abstraction.
 	conn := &Connection{
 		underlyingConn:                 underlyingConn,
 		connectionParams:               params,
+		connMutex:                      &sync.RWMutex{},
+		pendingResponses:               map[string]chan *pendingResponse{},
+		pendingMutex:                   &sync.Mutex{},
+		outboundQueue:                  make(chan *outboundFrame, sendQueueSize),
+		writerDoneChan:                 make(chan struct{}),
+		closedChan:                     make(chan struct{}),
+		doneChan:                       make(chan struct{}),
 		IncomingMessageHandler:         DefaultIncomingMessageHandler,
 		OutgoingMessageResponseHandler: DefaultOutgoingMessageResponseHandler,
 		ConnectionClosureHandler:       DefaultConnectionClosureHandler,
+		ConnectionEventHandler:         DefaultConnectionEventHandler,
+	}
+
+	// Applying the options before any message is read.
+	for _, opt := range opts {
+		opt(conn)
 	}
 
-	// Starting a separate goroutine to listen to websocket messages.
+	// Starting separate goroutines to read and write websocket messages.
 	go websocketMessageReader(ctx, conn)
+	go websocketMessageWriter(conn)
+
+	// Closing the connection when the context is cancelled.
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.closeWithReason(fmt.Errorf("connection context done: %w", ctx.Err()))
+		case <-conn.doneChan:
+		}
+	}()
+
 	return conn, nil
 }
 
 // SendMessage sends a new message synchronously.
 // It is a stateless way to send a message and hence does not need to be associated to a connection.
+//
+// If params.Retry is set, failed attempts are retried as per the policy.
+//
+// It creates a new Client upon every call. To pool the connections across many messages, use a Client instead.
 func SendMessage(ctx context.Context, request *OutgoingMessageReq, params *ConnectionParams) (
 	*OutgoingMessageRes, error,
+) {
+	client, err := NewClient(params)
+	if err != nil {
+		return nil, err
+	}
+	return client.Send(ctx, request)
+}
+
+// sendMessageOnce makes a single attempt to send the given message using the HTTP API.
+func sendMessageOnce(ctx context.Context, request *OutgoingMessageReq, params *ConnectionParams) (
+	*OutgoingMessageRes, error,
 ) {
 	request.SenderID = params.ClientID
 	// Marshalling the request to byte array.
@@ -69,20 +156,24 @@ func SendMessage(ctx context.Context, request *OutgoingMessageReq, params *Conne
 	// Converting the request byte array to io.Reader for the http client.
 	bodyReader := bytes.NewReader(requestBytes)
 
-	// Deciding on the protocol.
-	httpProtocol := getHTTPProtocol(params)
 	// Forming the endpoint.
-	endpoint := fmt.Sprintf("%s://%s/api/message", httpProtocol, params.BaseURL)
+	endpoint, err := getHTTPEndpoint(params, "api/message")
+	if err != nil {
+		return nil, err
+	}
 
 	// Forming the HTTP request.
-	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bodyReader)
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.String(), bodyReader)
 	if err != nil {
 		return nil, fmt.Errorf("failed to form the http request: %w", err)
 	}
 	httpRequest.Header.Set("x-request-id", request.RequestID)
+	if err := authenticate(ctx, params, httpRequest.Header); err != nil {
+		return nil, err
+	}
 
 	// Executing the request.
-	response, err := (&http.Client{}).Do(httpRequest)
+	response, err := getHTTPClient(params).Do(httpRequest)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute http request: %w", err)
 	}
@@ -90,14 +181,13 @@ func SendMessage(ctx context.Context, request *OutgoingMessageReq, params *Conne
 
 	// If the status code is not 2xx
 	if !isCode2xx(response.StatusCode) {
-		// Handling recognized errors.
-		if response.StatusCode == http.StatusTooManyRequests {
-			return nil, ErrTooManyReq
-		}
-
 		// Using the body content as the error body.
 		body, _ := anyToBytes(response.Body)
-		return nil, fmt.Errorf("http request failed: %s", string(body))
+		return nil, &StatusError{
+			StatusCode: response.StatusCode,
+			Body:       strings.TrimSpace(string(body)),
+			RetryAfter: parseRetryAfter(response.Header.Get("retry-after"), time.Now()),
+		}
 	}
 
 	// Decoding the response body.
@@ -107,18 +197,89 @@ func SendMessage(ctx context.Context, request *OutgoingMessageReq, params *Conne
 	}
 
 	// If the request failed completely, we create the error from the custom code of the response.
-	if outMessageRes.Code != codeOK {
+	if outMessageRes.Code != string(CodeOK) {
 		return nil, fmt.Errorf("request failed: %s", outMessageRes.Reason)
 	}
 
 	outMessageRes.RequestID = response.Header.Get("x-request-id")
+	outMessageRes.ReceiverIDs = request.ReceiverIDs
 	return outMessageRes, nil
 }
 
+// Messages returns the channel through which all incoming messages are delivered.
+//
+// It returns nil unless the connection is created with the WithMessagesChannel option.
+// The channel is closed when the connection closes.
+func (c *Connection) Messages() <-chan *IncomingEvent {
+	return c.messagesChan
+}
+
+// Responses returns the channel through which all outgoing message responses are delivered.
+//
+// It returns nil unless the connection is created with the WithResponsesChannel option.
+// The channel is closed when the connection closes.
+func (c *Connection) Responses() <-chan *ResponseEvent {
+	return c.responsesChan
+}
+
+// SendMessage sends a new message over the connection and waits for its response.
+//
+// The response is correlated with the request using the request ID, which is generated if not provided.
+// Unlike the package level SendMessage function, it does not require a separate HTTP call.
+func (c *Connection) SendMessage(ctx context.Context, request *OutgoingMessageReq) (*OutgoingMessageRes, error) {
+	request.SenderID = c.connectionParams.ClientID
+	if request.RequestID == "" {
+		request.RequestID = uuid.NewString()
+	}
+
+	// Registering the request before sending it, so the response cannot arrive before we are ready.
+	responseChan, err := c.addPendingResponse(request.RequestID)
+	if err != nil {
+		return nil, err
+	}
+	defer c.removePendingResponse(request.RequestID)
+
+	if err := c.SendMessageAsync(ctx, request); err != nil {
+		return nil, err
+	}
+
+	// Waiting for the response or the context expiry, whichever happens first.
+	select {
+	case pending := <-responseChan:
+		if pending.err != nil {
+			return nil, pending.err
+		}
+		// If the request failed completely, we create the error from the custom code of the response.
+		if pending.response.Code != string(CodeOK) {
+			return nil, fmt.Errorf("request failed: %s", pending.response.Reason)
+		}
+		pending.response.ReceiverIDs = request.ReceiverIDs
+		return pending.response, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("failed to receive response: %w", ctx.Err())
+	}
+}
+
 // SendMessageAsync sends a new message asynchronously.
 // It uses the websocket connection for sending the message.
 // The response of this request can be handled through the ResponseHandler function.
+//
+// It is safe for concurrent use. The message is queued for writing and the call returns once it is written. If too
+// many messages are already waiting to be written, it fails with ErrSendQueueFull.
+//
+// If the Signing and Encryption params of the connection require it, the message is signed and encrypted for its
+// receivers, without modifying the given request.
 func (c *Connection) SendMessageAsync(ctx context.Context, request *OutgoingMessageReq) error {
+	// No new messages are accepted once the closure is initiated.
+	if c.isClosedByUser() {
+		return ErrConnectionClosed
+	}
+
+	request, err := prepareRequest(request, c.connectionParams)
+	if err != nil {
+		return err
+	}
+
 	message := &BridgeMessage{
 		Type:      typeOutgoingMessageReq,
 		RequestID: request.RequestID,
@@ -132,46 +293,422 @@ func (c *Connection) SendMessageAsync(ctx context.Context, request *OutgoingMess
 	}
 
 	// Writing the message to the connection.
-	if err := c.underlyingConn.WriteMessage(websocket.TextMessage, messageBytes); err != nil {
+	if err := c.sendFrame(ctx, websocket.TextMessage, messageBytes); err != nil {
 		return fmt.Errorf("failed to write message: %w", err)
 	}
 	return nil
 }
 
-// Close closes the underlying connection.
+// Close gracefully closes the connection.
+//
+// It queues a close frame for Rosenbridge and returns without waiting for the acknowledgement. Messages queued before
+// the call are still written. The Done channel can be used to wait until the connection is fully closed. A closed
+// connection is never re-established.
 func (c *Connection) Close() error {
-	if err := c.underlyingConn.Close(); err != nil {
-		return fmt.Errorf("failed to close underlying conn: %w", err)
+	c.closeWithReason(nil)
+	return nil
+}
+
+// Done returns a channel that is closed after the connection is fully closed, all in-flight handler calls have
+// returned and the ConnectionClosureHandler has been invoked.
+func (c *Connection) Done() <-chan struct{} {
+	return c.doneChan
+}
+
+// Err returns the reason of the connection closure.
+//
+// It returns nil if the connection is not closed yet, or if it was closed using the Close method.
+func (c *Connection) Err() error {
+	select {
+	case <-c.doneChan:
+	default:
+		return nil
+	}
+
+	switch asserted := c.closureErr.(type) {
+	case nil:
+		return nil
+	case error:
+		return asserted
+	default:
+		return fmt.Errorf("%v", asserted)
 	}
+}
+
+// closeWithReason initiates the closure of the connection with the given reason.
+// Only the first call has any effect, the subsequent ones are no-op.
+func (c *Connection) closeWithReason(reason error) {
+	c.connMutex.Lock()
+	if c.isClosed {
+		c.connMutex.Unlock()
+		return
+	}
+
+	c.isClosed, c.closeReason = true, reason
+	close(c.closedChan)
+	c.connMutex.Unlock()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), closeHandshakeTimeout)
+		defer cancel()
+
+		// Sending the close frame, so Rosenbridge knows that the bridge is gone.
+		closeMessage := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+		if err := c.sendCloseFrame(ctx, closeMessage); err != nil {
+			// The connection is probably broken already, so there's no handshake to wait for.
+			_ = c.getUnderlyingConn().Close()
+			return
+		}
+
+		// The reader closes the underlying connection once Rosenbridge acknowledges the close frame.
+		// If that does not happen in time, the connection is closed forcefully.
+		select {
+		case <-c.doneChan:
+		case <-ctx.Done():
+			_ = c.getUnderlyingConn().Close()
+		}
+	}()
+}
+
+// sendCloseFrame queues the given close frame and waits until it is written.
+// Unlike other frames, it waits for room in the queue, so that the already queued messages are not discarded.
+func (c *Connection) sendCloseFrame(ctx context.Context, closeMessage []byte) error {
+	frame := &outboundFrame{messageType: websocket.CloseMessage, data: closeMessage, result: make(chan error, 1)}
+
+	select {
+	case c.outboundQueue <- frame:
+	case <-c.writerDoneChan:
+		return ErrConnectionClosed
+	case <-ctx.Done():
+		return fmt.Errorf("close frame not queued: %w", ctx.Err())
+	}
+
+	return c.awaitFrame(ctx, frame)
+}
+
+// getCloseReason provides the reason with which the connection was closed.
+func (c *Connection) getCloseReason() error {
+	c.connMutex.RLock()
+	defer c.connMutex.RUnlock()
+	return c.closeReason
+}
+
+// addPendingResponse registers the given request ID as awaiting a response, and returns the channel through which
+// the response will be delivered.
+func (c *Connection) addPendingResponse(requestID string) (<-chan *pendingResponse, error) {
+	c.pendingMutex.Lock()
+	defer c.pendingMutex.Unlock()
+
+	if _, exists := c.pendingResponses[requestID]; exists {
+		return nil, fmt.Errorf("%w: %s", ErrDuplicateRequestID, requestID)
+	}
+
+	// The channel is buffered so the reader never blocks upon it.
+	responseChan := make(chan *pendingResponse, 1)
+	c.pendingResponses[requestID] = responseChan
+	return responseChan, nil
+}
+
+// removePendingResponse removes the given request ID from the pending responses.
+func (c *Connection) removePendingResponse(requestID string) {
+	c.pendingMutex.Lock()
+	defer c.pendingMutex.Unlock()
+	delete(c.pendingResponses, requestID)
+}
+
+// resolvePendingResponse delivers the given response to its waiting request, if there is one.
+// It returns false if no request is waiting for this response.
+func (c *Connection) resolvePendingResponse(requestID string, pending *pendingResponse) bool {
+	c.pendingMutex.Lock()
+	defer c.pendingMutex.Unlock()
+
+	responseChan, exists := c.pendingResponses[requestID]
+	if !exists {
+		return false
+	}
+
+	// Removing the entry so the response is delivered only once.
+	delete(c.pendingResponses, requestID)
+	responseChan <- pending
+	return true
+}
+
+// failPendingResponses fails all the waiting requests with the given error.
+// It is used when the connection breaks, since the responses can no longer arrive.
+func (c *Connection) failPendingResponses(err error) {
+	c.pendingMutex.Lock()
+	defer c.pendingMutex.Unlock()
+
+	for requestID, responseChan := range c.pendingResponses {
+		delete(c.pendingResponses, requestID)
+		responseChan <- &pendingResponse{err: err}
+	}
+}
+
+// getUnderlyingConn provides the current low-level connection in a concurrency-safe manner.
+func (c *Connection) getUnderlyingConn() *websocket.Conn {
+	c.connMutex.RLock()
+	defer c.connMutex.RUnlock()
+	return c.underlyingConn
+}
+
+// replaceUnderlyingConn swaps the current low-level connection with the provided one.
+// If the connection was closed in the meantime, the provided one is closed too and ErrConnectionClosed is returned.
+func (c *Connection) replaceUnderlyingConn(underlyingConn *websocket.Conn) error {
+	c.connMutex.Lock()
+	defer c.connMutex.Unlock()
+
+	if c.isClosed {
+		_ = underlyingConn.Close()
+		return ErrConnectionClosed
+	}
+
+	c.underlyingConn = underlyingConn
 	return nil
 }
 
+// isClosedByUser tells whether the connection was closed using the Close method.
+func (c *Connection) isClosedByUser() bool {
+	c.connMutex.RLock()
+	defer c.connMutex.RUnlock()
+	return c.isClosed
+}
+
+// shouldReconnect tells whether the connection should be re-established after a failure.
+func (c *Connection) shouldReconnect() bool {
+	return c.connectionParams.Reconnect != nil && !c.isClosedByUser()
+}
+
+// reconnect redials Rosenbridge with exponential backoff until it succeeds or the attempts are exhausted.
+// The provided cause is the error that broke the previous connection.
+func (c *Connection) reconnect(ctx context.Context, cause error) error {
+	params := c.connectionParams.Reconnect
+
+	for attempt := 1; params.MaxAttempts <= 0 || attempt <= params.MaxAttempts; attempt++ {
+		delay := backoffDelay(params.InitialBackoff, params.MaxBackoff, params.Multiplier, params.Jitter, attempt)
+		c.ConnectionEventHandler(ctx, &ConnectionEvent{
+			Type: EventReconnecting, Attempt: attempt, Delay: delay, Err: cause,
+		})
+
+		// Waiting for the backoff duration to elapse.
+		select {
+		case <-time.After(delay):
+		case <-c.closedChan:
+			return ErrConnectionClosed
+		case <-ctx.Done():
+			return fmt.Errorf("reconnection aborted: %w", ctx.Err())
+		}
+
+		// The user may have closed the connection while we were waiting.
+		if !c.shouldReconnect() {
+			return ErrConnectionClosed
+		}
+
+		underlyingConn, err := dialBridge(ctx, c.connectionParams)
+		// Retrying won't help if the credentials are rejected.
+		if errors.Is(err, ErrUnauthorized) {
+			return fmt.Errorf("failed to reconnect: %w", err)
+		}
+		if err != nil {
+			cause = err
+			continue
+		}
+
+		if err := c.replaceUnderlyingConn(underlyingConn); err != nil {
+			return err
+		}
+
+		c.ConnectionEventHandler(ctx, &ConnectionEvent{Type: EventReconnected, Attempt: attempt})
+		return nil
+	}
+
+	return fmt.Errorf("failed to reconnect after %d attempts: %w", params.MaxAttempts, cause)
+}
+
+// dialBridge establishes a new websocket connection with Rosenbridge.
+func dialBridge(ctx context.Context, params *ConnectionParams) (*websocket.Conn, error) {
+	// Forming the API endpoint URL.
+	endpoint, err := getWebsocketEndpoint(params)
+	if err != nil {
+		return nil, err
+	}
+
+	// Adding the credentials to the handshake.
+	header := http.Header{}
+	if err := authenticate(ctx, params, header); err != nil {
+		return nil, err
+	}
+
+	// Establishing websocket connection.
+	underlyingConn, response, err := getDialer(params).DialContext(ctx, endpoint.String(), header)
+	if err != nil {
+		// A rejected handshake is reported with its status code, so callers can tell, for example, auth failures.
+		if response != nil {
+			defer func() { _ = response.Body.Close() }()
+			body, _ := anyToBytes(response.Body)
+			err = &StatusError{StatusCode: response.StatusCode, Body: strings.TrimSpace(string(body))}
+		}
+		return nil, fmt.Errorf("error in websocket.Dial: %w", err)
+	}
+	defer func() { _ = response.Body.Close() }()
+
+	return underlyingConn, nil
+}
+
 // websocketMessageReader manages the websocket connection and messages by calling appropriate handlers.
-//
-//nolint:cyclop
+// If reconnection is enabled, it re-establishes the connection whenever it breaks.
 func websocketMessageReader(ctx context.Context, conn *Connection) {
 	// This routine returns when the connection closes.
-	defer conn.ConnectionClosureHandler(ctx, recover())
+	defer func() {
+		// Panics in the handlers are also treated as closure reasons.
+		if recovered := recover(); recovered != nil {
+			conn.closureErr = recovered
+		}
+
+		_ = conn.getUnderlyingConn().Close()
+		conn.failPendingResponses(ErrConnectionClosed)
+		conn.ConnectionClosureHandler(ctx, conn.closureErr)
+		conn.closeEventChannels()
+		close(conn.doneChan)
+	}()
 
+	for {
+		// This returns only when the underlying connection breaks.
+		underlyingConn := conn.getUnderlyingConn()
+		stopKeepalive := conn.startKeepalive(underlyingConn)
+		err := readBridgeMessages(ctx, conn, underlyingConn)
+		stopKeepalive()
+
+		// Responses of the requests sent over the broken connection will never arrive.
+		conn.failPendingResponses(fmt.Errorf("connection broke before response: %w", err))
+
+		if !conn.shouldReconnect() {
+			conn.closureErr = err
+			// If the connection was closed deliberately, the provided reason is used instead of the read error.
+			if conn.isClosedByUser() {
+				conn.closureErr = conn.getCloseReason()
+			}
+			return
+		}
+
+		// Attempting to re-establish the connection.
+		if errReconnect := conn.reconnect(ctx, err); errReconnect != nil {
+			conn.closureErr = errReconnect
+			if errors.Is(errReconnect, ErrConnectionClosed) {
+				conn.closureErr = conn.getCloseReason()
+			}
+			return
+		}
+	}
+}
+
+// deliverIncoming passes the given incoming message (or error) to the handler and the messages channel.
+func (c *Connection) deliverIncoming(ctx context.Context, message *IncomingMessageReq, err error) {
+	c.IncomingMessageHandler(ctx, message, err)
+	if c.messagesChan == nil {
+		return
+	}
+
+	event := &IncomingEvent{Message: message, Err: err}
+	switch c.messagesPolicy {
+	case OverflowDropNewest:
+		select {
+		case c.messagesChan <- event:
+		default:
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case c.messagesChan <- event:
+				return
+			default:
+				// Discarding the oldest event to make room. Someone else may have consumed it already, that's fine.
+				select {
+				case <-c.messagesChan:
+				default:
+				}
+			}
+		}
+	case OverflowBlock:
+		fallthrough
+	default:
+		select {
+		case c.messagesChan <- event:
+		case <-c.closedChan:
+		}
+	}
+}
+
+// deliverResponse passes the given outgoing message response (or error) to the handler and the responses channel.
+func (c *Connection) deliverResponse(ctx context.Context, response *OutgoingMessageRes, err error) {
+	c.OutgoingMessageResponseHandler(ctx, response, err)
+	if c.responsesChan == nil {
+		return
+	}
+
+	event := &ResponseEvent{Response: response, Err: err}
+	switch c.responsesPolicy {
+	case OverflowDropNewest:
+		select {
+		case c.responsesChan <- event:
+		default:
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case c.responsesChan <- event:
+				return
+			default:
+				// Discarding the oldest event to make room. Someone else may have consumed it already, that's fine.
+				select {
+				case <-c.responsesChan:
+				default:
+				}
+			}
+		}
+	case OverflowBlock:
+		fallthrough
+	default:
+		select {
+		case c.responsesChan <- event:
+		case <-c.closedChan:
+		}
+	}
+}
+
+// closeEventChannels closes the event channels, if they are enabled.
+func (c *Connection) closeEventChannels() {
+	if c.messagesChan != nil {
+		close(c.messagesChan)
+	}
+	if c.responsesChan != nil {
+		close(c.responsesChan)
+	}
+}
+
+// readBridgeMessages reads all messages from the given low-level connection and calls appropriate handlers.
+// It returns when the connection breaks.
+//
+//nolint:cyclop
+func readBridgeMessages(ctx context.Context, conn *Connection, underlyingConn *websocket.Conn) error {
 	// Starting an infinite loop to process all websocket communication.
-	// This loop panics when the connection is closed.
 	for {
-		wsMessageType, message, err := conn.underlyingConn.ReadMessage()
+		// The deadline is armed right before every read, so the time spent in the handlers is not mistaken for a dead
+		// peer. Every frame received during the read pushes it further.
+		conn.extendReadDeadline(underlyingConn)
+
+		wsMessageType, message, err := underlyingConn.ReadMessage()
 		if err != nil {
-			// This invokes the ClosureHandler with the given error.
-			panic(fmt.Errorf("error in ReadMessage: %w", err))
+			return wrapReadError(err)
 		}
 
 		// Handling different websocket message types.
 		switch wsMessageType {
-		case websocket.CloseMessage:
-			// This closes the connection with nil error.
-			panic(nil)
 		case websocket.TextMessage:
 			bridgeMessage := &BridgeMessage{}
 			if err := anyToAny(message, bridgeMessage); err != nil {
 				// If the message type fails to be determined, we assume it to be an incoming message.
-				conn.IncomingMessageHandler(ctx, nil, fmt.Errorf("failed to decode message: %w", err))
+				conn.deliverIncoming(ctx, nil, fmt.Errorf("failed to decode message: %w", err))
 				continue
 			}
 
@@ -180,22 +717,44 @@ func websocketMessageReader(ctx context.Context, conn *Connection) {
 			case typeIncomingMessageReq:
 				inMessageReq := &IncomingMessageReq{}
 				if err := anyToAny(bridgeMessage.Body, inMessageReq); err != nil {
-					conn.IncomingMessageHandler(ctx, nil,
+					conn.deliverIncoming(ctx, nil,
 						fmt.Errorf("failed to unmarshal message: %w", err))
 					continue
 				}
-				conn.IncomingMessageHandler(ctx, inMessageReq, nil)
+				inMessageReq.RequestID = bridgeMessage.RequestID
+				// Encrypted messages are delivered decrypted, or as an error if that is not possible.
+				// Signed messages are delivered verified, unless they are to be dropped.
+				shouldDeliver, err := openIncoming(inMessageReq, conn.connectionParams)
+				if err != nil {
+					conn.deliverIncoming(ctx, nil, err)
+					continue
+				}
+				if shouldDeliver {
+					conn.deliverIncoming(ctx, inMessageReq, nil)
+				}
 			case typeOutgoingMessageRes:
 				outMessageRes := &OutgoingMessageRes{}
 				if err := anyToAny(bridgeMessage.Body, outMessageRes); err != nil {
-					conn.OutgoingMessageResponseHandler(ctx, nil,
-						fmt.Errorf("failed to unmarshal message: %w", err))
+					err = fmt.Errorf("failed to unmarshal message: %w", err)
+					// If a synchronous request is waiting for this response, it receives the error.
+					if !conn.resolvePendingResponse(bridgeMessage.RequestID, &pendingResponse{err: err}) {
+						conn.deliverResponse(ctx, nil, err)
+					}
 					continue
 				}
-				conn.OutgoingMessageResponseHandler(ctx, outMessageRes, nil)
+
+				// Responses of synchronous requests are not passed to the handler.
+				outMessageRes.RequestID = bridgeMessage.RequestID
+				if !conn.resolvePendingResponse(bridgeMessage.RequestID, &pendingResponse{response: outMessageRes}) {
+					conn.deliverResponse(ctx, outMessageRes, nil)
+				}
 			case typeErrorRes:
-				// If the response type is error, we assume it to be an incoming message.
-				conn.IncomingMessageHandler(ctx, nil, errors.New("unknown error"))
+				err := errors.New("unknown error")
+				// If a synchronous request is waiting for this response, it receives the error.
+				// Otherwise, we assume it to be an incoming message.
+				if !conn.resolvePendingResponse(bridgeMessage.RequestID, &pendingResponse{err: err}) {
+					conn.deliverIncoming(ctx, nil, err)
+				}
 			default:
 				// Unknown message types are simply ignored.
 			}
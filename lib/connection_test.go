@@ -0,0 +1,576 @@
+package lib_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shivanshkc/rosenbridge-cli/lib"
+	"github.com/shivanshkc/rosenbridge-cli/lib/rosentest"
+
+	"github.com/gorilla/websocket"
+)
+
+// testTimeout bounds every wait in the tests, so a hang fails the test instead of blocking it forever.
+const testTimeout = 5 * time.Second
+
+func TestConnection_SendMessage_ErrorResponse(t *testing.T) {
+	// A server that rejects every request with an ERROR_RES frame carrying its request ID.
+	upgrader := &websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		conn, err := upgrader.Upgrade(writer, req, nil)
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+
+		for {
+			message := &lib.BridgeMessage{}
+			if err := conn.ReadJSON(message); err != nil {
+				return
+			}
+			_ = conn.WriteJSON(&lib.BridgeMessage{Type: "ERROR_RES", RequestID: message.RequestID})
+		}
+	}))
+	defer server.Close()
+
+	endpoint, err := lib.ParseEndpoint(server.URL)
+	if err != nil {
+		t.Fatalf("failed to parse endpoint: %v", err)
+	}
+
+	var unhandled []error
+	conn, err := lib.NewConnection(context.Background(), &lib.ConnectionParams{ClientID: "alice", Endpoint: endpoint},
+		lib.WithIncomingMessageHandler(func(ctx context.Context, message *lib.IncomingMessageReq, err error) {
+			unhandled = append(unhandled, err)
+		}),
+	)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	// The error must reach the waiting caller instead of the incoming message handler.
+	_, err = conn.SendMessage(ctx, &lib.OutgoingMessageReq{Message: "hello", ReceiverIDs: []string{"bob"}})
+	if err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the error response, got: %v", err)
+	}
+
+	_ = conn.Close()
+	<-conn.Done()
+	if len(unhandled) != 0 {
+		t.Fatalf("expected no errors for the incoming message handler, got: %v", unhandled)
+	}
+}
+
+func TestConnection_SlowHandler_NotStale(t *testing.T) {
+	server := rosentest.NewServer()
+	defer server.Close()
+
+	params := server.ConnectionParams("alice")
+	params.PingInterval, params.PongTimeout = 50*time.Millisecond, 50*time.Millisecond
+
+	// The handler takes several times longer than the keepalive window.
+	received := make(chan string, 2)
+	conn := connect(t, server, params,
+		lib.WithIncomingMessageHandler(func(ctx context.Context, message *lib.IncomingMessageReq, err error) {
+			if err != nil {
+				return
+			}
+			time.Sleep(4 * (params.PingInterval + params.PongTimeout))
+			received <- message.Message
+		}),
+	)
+
+	for _, message := range []string{"first", "second"} {
+		request := &lib.OutgoingMessageReq{Message: message, ReceiverIDs: []string{"alice"}}
+		if _, err := lib.SendMessage(context.Background(), request, server.ConnectionParams("bob")); err != nil {
+			t.Fatalf("failed to send message: %v", err)
+		}
+	}
+
+	for _, expected := range []string{"first", "second"} {
+		select {
+		case message := <-received:
+			if message != expected {
+				t.Fatalf("expected message %q, got %q", expected, message)
+			}
+		case <-conn.Done():
+			t.Fatalf("connection closed while the handler was running: %v", conn.Err())
+		case <-time.After(testTimeout):
+			t.Fatalf("message %q not received", expected)
+		}
+	}
+}
+
+func TestConnection_ConcurrentSenders(t *testing.T) {
+	server := rosentest.NewServer()
+	defer server.Close()
+
+	const senders, messagesPerSender = 50, 20
+	const total = senders * messagesPerSender
+
+	bob := connect(t, server, server.ConnectionParams("bob"), lib.WithMessagesChannel(total, lib.OverflowBlock))
+
+	// The queue has room for all messages, so no sender gets the backpressure.
+	aliceParams := server.ConnectionParams("alice")
+	aliceParams.SendQueueSize = total
+	alice := connect(t, server, aliceParams)
+
+	// Half of the senders wait for the responses, the other half do not.
+	errChan := make(chan error, total)
+	for i := 0; i < senders; i++ {
+		go func(isSync bool) {
+			for j := 0; j < messagesPerSender; j++ {
+				request := &lib.OutgoingMessageReq{Message: "hello", ReceiverIDs: []string{"bob"}}
+				if !isSync {
+					errChan <- alice.SendMessageAsync(context.Background(), request)
+					continue
+				}
+
+				ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+				_, err := alice.SendMessage(ctx, request)
+				cancel()
+				errChan <- err
+			}
+		}(i%2 == 0)
+	}
+
+	for i := 0; i < total; i++ {
+		if err := <-errChan; err != nil {
+			t.Fatalf("failed to send message: %v", err)
+		}
+	}
+
+	// Every message must arrive intact.
+	for i := 0; i < total; i++ {
+		select {
+		case event := <-bob.Messages():
+			if event.Err != nil || event.Message.Message != "hello" {
+				t.Fatalf("unexpected event: %+v", event)
+			}
+		case <-time.After(testTimeout):
+			t.Fatalf("received %d of %d messages", i, total)
+		}
+	}
+}
+
+func TestConnection_SendMessageAsync_QueueFull(t *testing.T) {
+	// A server that never reads, so the writes eventually block and the queue fills up.
+	release := make(chan struct{})
+	upgrader := &websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		conn, err := upgrader.Upgrade(writer, req, nil)
+		if err != nil {
+			return
+		}
+		<-release
+		_ = conn.Close()
+	}))
+	defer server.Close()
+	defer close(release)
+
+	endpoint, err := lib.ParseEndpoint(server.URL)
+	if err != nil {
+		t.Fatalf("failed to parse endpoint: %v", err)
+	}
+
+	conn, err := lib.NewConnection(context.Background(),
+		&lib.ConnectionParams{ClientID: "alice", Endpoint: endpoint, SendQueueSize: 1},
+		lib.WithConnectionClosureHandler(func(ctx context.Context, err interface{}) {}),
+	)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	// The frames stay queued when the wait for them times out, so the large ones fill the socket buffers and the queue.
+	request := &lib.OutgoingMessageReq{Message: strings.Repeat("x", 1<<20), ReceiverIDs: []string{"bob"}}
+	deadline := time.Now().Add(testTimeout)
+	for time.Now().Before(deadline) {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		err := conn.SendMessageAsync(ctx, request)
+		cancel()
+
+		if errors.Is(err, lib.ErrSendQueueFull) {
+			return
+		}
+		if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected ErrSendQueueFull or a timeout, got: %v", err)
+		}
+	}
+	t.Fatal("ErrSendQueueFull not returned in time")
+}
+
+func TestConnection_CloseDuringSends(t *testing.T) {
+	server := rosentest.NewServer()
+	defer server.Close()
+
+	connect(t, server, server.ConnectionParams("bob"))
+	alice := connect(t, server, server.ConnectionParams("alice"))
+
+	// Senders keep sending until the connection refuses them.
+	const senders = 20
+	doneChan := make(chan error, senders)
+	for i := 0; i < senders; i++ {
+		go func() {
+			for {
+				request := &lib.OutgoingMessageReq{Message: "hello", ReceiverIDs: []string{"bob"}}
+				err := alice.SendMessageAsync(context.Background(), request)
+				if errors.Is(err, lib.ErrSendQueueFull) {
+					continue
+				}
+				if err != nil {
+					doneChan <- err
+					return
+				}
+			}
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if err := alice.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+
+	// Every sender must be released, none of them may hang on a frame that is never written.
+	for i := 0; i < senders; i++ {
+		select {
+		case <-doneChan:
+		case <-time.After(testTimeout):
+			t.Fatalf("%d of %d senders still blocked after close", senders-i, senders)
+		}
+	}
+
+	select {
+	case <-alice.Done():
+	case <-time.After(testTimeout):
+		t.Fatal("connection not done after close")
+	}
+	if err := alice.Err(); err != nil {
+		t.Fatalf("expected no closure error, got: %v", err)
+	}
+
+	err := alice.SendMessageAsync(context.Background(), &lib.OutgoingMessageReq{ReceiverIDs: []string{"bob"}})
+	if !errors.Is(err, lib.ErrConnectionClosed) {
+		t.Fatalf("expected ErrConnectionClosed, got: %v", err)
+	}
+}
+
+// closureRecorder records the calls of a ConnectionClosureHandlerFunc.
+type closureRecorder struct {
+	mutex sync.Mutex
+	errs  []interface{}
+}
+
+// option provides the option that sets the recorder as the closure handler.
+func (c *closureRecorder) option() lib.ConnectionOption {
+	return lib.WithConnectionClosureHandler(func(ctx context.Context, err interface{}) {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		c.errs = append(c.errs, err)
+	})
+}
+
+// count provides the number of calls so far.
+func (c *closureRecorder) count() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.errs)
+}
+
+// assertOnce fails the test unless the handler was called exactly once, with the given error. It should be called
+// after the connection is done, and it waits a little, so a late second call is caught too.
+func (c *closureRecorder) assertOnce(t *testing.T, expected error) {
+	t.Helper()
+
+	time.Sleep(50 * time.Millisecond)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if len(c.errs) != 1 {
+		t.Fatalf("expected the closure handler to be called once, got %d calls: %v", len(c.errs), c.errs)
+	}
+	if actual, _ := c.errs[0].(error); actual != expected { //nolint:errorlint // The very same error is expected.
+		t.Fatalf("expected the closure handler to get %v, got %v", expected, c.errs[0])
+	}
+}
+
+// connect creates a connection with the given params, and waits until the server registers its bridge.
+// The connection is closed when the test ends.
+func connect(t *testing.T, server *rosentest.Server, params *lib.ConnectionParams,
+	opts ...lib.ConnectionOption,
+) *lib.Connection {
+	t.Helper()
+
+	conn, err := lib.NewConnection(context.Background(), params, opts...)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	waitForBridge(t, server, params.ClientID)
+	return conn
+}
+
+// waitForBridge waits until the server registers a bridge of the given client, as that happens slightly after the
+// handshake completes on the client side.
+func waitForBridge(t *testing.T, server *rosentest.Server, clientID string) {
+	t.Helper()
+
+	deadline := time.Now().Add(testTimeout)
+	for server.BridgeCount(clientID) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("bridge of %s not registered", clientID)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestConnection_Reconnect(t *testing.T) {
+	server := rosentest.NewServer()
+	defer server.Close()
+
+	params := server.ConnectionParams("bob")
+	params.Reconnect = &lib.ReconnectParams{InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+	events := make(chan *lib.ConnectionEvent, 16)
+	closures := &closureRecorder{}
+	bob := connect(t, server, params,
+		lib.WithMessagesChannel(1, lib.OverflowDropNewest),
+		lib.WithConnectionEventHandler(func(ctx context.Context, event *lib.ConnectionEvent) { events <- event }),
+		closures.option(),
+	)
+
+	server.DropConnections("bob")
+
+	// The connection announces the redial, and then its success.
+	for _, expected := range []lib.ConnectionEventType{lib.EventReconnecting, lib.EventReconnected} {
+		select {
+		case event := <-events:
+			if event.Type != expected || event.Attempt != 1 {
+				t.Fatalf("expected the first %s event, got: %+v", expected, event)
+			}
+			if expected == lib.EventReconnecting && event.Err == nil {
+				t.Fatal("expected the reconnecting event to carry the cause")
+			}
+		case <-time.After(testTimeout):
+			t.Fatalf("%s event not emitted", expected)
+		}
+	}
+	waitForBridge(t, server, "bob")
+
+	// The messages flow again, over the new bridge.
+	request := &lib.OutgoingMessageReq{Message: "hello again", ReceiverIDs: []string{"bob"}}
+	if _, err := lib.SendMessage(context.Background(), request, server.ConnectionParams("alice")); err != nil {
+		t.Fatalf("failed to send message: %v", err)
+	}
+	select {
+	case event := <-bob.Messages():
+		if event.Err != nil || event.Message.Message != "hello again" {
+			t.Fatalf("unexpected event: %+v", event)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("message not received after the reconnection")
+	}
+
+	if calls := closures.count(); calls != 0 {
+		t.Fatalf("expected no closures, got %d", calls)
+	}
+}
+
+func TestConnection_Reconnect_MaxAttempts(t *testing.T) {
+	server := rosentest.NewServer()
+	defer server.Close()
+
+	params := server.ConnectionParams("bob")
+	params.Reconnect = &lib.ReconnectParams{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+	var reconnecting int
+	closures := &closureRecorder{}
+	bob := connect(t, server, params,
+		lib.WithConnectionEventHandler(func(ctx context.Context, event *lib.ConnectionEvent) {
+			if event.Type == lib.EventReconnecting {
+				reconnecting++
+			}
+		}),
+		closures.option(),
+	)
+
+	// Every redial is rejected.
+	server.FailNextRequests(10, http.StatusServiceUnavailable)
+	server.DropConnections("bob")
+
+	select {
+	case <-bob.Done():
+	case <-time.After(testTimeout):
+		t.Fatal("connection not closed after the attempts ran out")
+	}
+
+	var statusErr *lib.StatusError
+	if err := bob.Err(); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected the error of the last attempt, got: %v", err)
+	}
+	if reconnecting != 3 {
+		t.Fatalf("expected 3 reconnecting events, got %d", reconnecting)
+	}
+	closures.assertOnce(t, bob.Err())
+}
+
+func TestConnection_Reconnect_Unauthorized(t *testing.T) {
+	server := rosentest.NewServer()
+	defer server.Close()
+
+	params := server.ConnectionParams("bob")
+	params.Reconnect = &lib.ReconnectParams{InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+	closures := &closureRecorder{}
+	bob := connect(t, server, params, closures.option())
+
+	// Rejected credentials are not retried, even without a limit on the attempts.
+	server.RequireBearerToken("secret")
+	server.DropConnections("bob")
+
+	select {
+	case <-bob.Done():
+	case <-time.After(testTimeout):
+		t.Fatal("connection not closed after the credentials were rejected")
+	}
+	if err := bob.Err(); !errors.Is(err, lib.ErrUnauthorized) {
+		t.Fatalf("expected ErrUnauthorized, got: %v", err)
+	}
+	closures.assertOnce(t, bob.Err())
+}
+
+func TestConnection_Reconnect_Close(t *testing.T) {
+	server := rosentest.NewServer()
+	defer server.Close()
+
+	params := server.ConnectionParams("bob")
+	params.Reconnect = &lib.ReconnectParams{InitialBackoff: time.Hour, MaxBackoff: time.Hour}
+
+	reconnecting := make(chan struct{}, 1)
+	closures := &closureRecorder{}
+	bob := connect(t, server, params,
+		lib.WithConnectionEventHandler(func(ctx context.Context, event *lib.ConnectionEvent) {
+			reconnecting <- struct{}{}
+		}),
+		closures.option(),
+	)
+
+	server.DropConnections("bob")
+	select {
+	case <-reconnecting:
+	case <-time.After(testTimeout):
+		t.Fatal("reconnecting event not emitted")
+	}
+
+	// Closing the connection cuts the backoff short.
+	_ = bob.Close()
+	select {
+	case <-bob.Done():
+	case <-time.After(testTimeout):
+		t.Fatal("connection not closed while waiting to reconnect")
+	}
+	if err := bob.Err(); err != nil {
+		t.Fatalf("expected no closure error, got: %v", err)
+	}
+	closures.assertOnce(t, nil)
+}
+
+func TestConnection_Closure(t *testing.T) {
+	testCases := []struct {
+		name string
+		// closeConn closes the connection in the way under test.
+		closeConn func(server *rosentest.Server, conn *lib.Connection, cancel context.CancelFunc)
+		// checkErr checks the closure error.
+		checkErr func(err error) bool
+	}{
+		{
+			name:      "close",
+			closeConn: func(server *rosentest.Server, conn *lib.Connection, cancel context.CancelFunc) { _ = conn.Close() },
+			checkErr:  func(err error) bool { return err == nil },
+		},
+		{
+			name:      "context canceled",
+			closeConn: func(server *rosentest.Server, conn *lib.Connection, cancel context.CancelFunc) { cancel() },
+			checkErr:  func(err error) bool { return errors.Is(err, context.Canceled) },
+		},
+		{
+			name: "dropped by the server",
+			closeConn: func(server *rosentest.Server, conn *lib.Connection, cancel context.CancelFunc) {
+				server.DropConnections("bob")
+			},
+			checkErr: func(err error) bool { return err != nil && !errors.Is(err, context.Canceled) },
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			server := rosentest.NewServer()
+			defer server.Close()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// The reconnection is disabled, so any closure is final.
+			closures := &closureRecorder{}
+			conn, err := lib.NewConnection(ctx, server.ConnectionParams("bob"),
+				lib.WithMessagesChannel(1, lib.OverflowDropNewest), closures.option())
+			if err != nil {
+				t.Fatalf("failed to connect: %v", err)
+			}
+			waitForBridge(t, server, "bob")
+
+			// Nothing is reported before the closure.
+			select {
+			case <-conn.Done():
+				t.Fatal("connection done before the closure")
+			default:
+			}
+			if err := conn.Err(); err != nil {
+				t.Fatalf("expected no error before the closure, got: %v", err)
+			}
+
+			testCase.closeConn(server, conn, cancel)
+			select {
+			case <-conn.Done():
+			case <-time.After(testTimeout):
+				t.Fatal("connection not done after the closure")
+			}
+
+			closureErr := conn.Err()
+			if !testCase.checkErr(closureErr) {
+				t.Fatalf("unexpected closure error: %v", closureErr)
+			}
+			// The handler gets the same reason as Err, and closing again changes nothing.
+			_ = conn.Close()
+			cancel()
+			closures.assertOnce(t, closureErr)
+			if err := conn.Err(); err != closureErr { //nolint:errorlint // The very same error is expected.
+				t.Fatalf("expected the closure error to stay %v, got: %v", closureErr, err)
+			}
+
+			// The channels are closed, and no new messages are accepted.
+			if _, open := <-conn.Messages(); open {
+				t.Fatal("expected the messages channel to be closed")
+			}
+			err = conn.SendMessageAsync(context.Background(), &lib.OutgoingMessageReq{ReceiverIDs: []string{"alice"}})
+			if err == nil {
+				t.Fatal("expected sending over a closed connection to fail")
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Err converts the status into one of ErrReceiverOffline, ErrBridgeNotFound or ErrDeliveryFailed.
+// It returns nil for CodeOK.
+func (d DeliveryStatus) Err() error {
+	switch d {
+	case CodeOK:
+		return nil
+	case CodeOffline:
+		return ErrReceiverOffline
+	case CodeBridgeNotFound:
+		return ErrBridgeNotFound
+	case CodeUnknown:
+		return ErrDeliveryFailed
+	default:
+		return ErrDeliveryFailed
+	}
+}
+
+// ReceiverStatus provides the delivery status of the message for the given receiver.
+//
+// The message counts as delivered if it reached at least one bridge of the receiver. Otherwise, the status of the
+// first failed bridge is provided. CodeUnknown is provided if the receiver is absent from the report.
+func (r *OutgoingMessageRes) ReceiverStatus(receiverID string) DeliveryStatus {
+	reports := r.Report[receiverID]
+	if len(reports) == 0 {
+		return CodeUnknown
+	}
+
+	for _, report := range reports {
+		if report.Code == CodeOK {
+			return CodeOK
+		}
+	}
+	return reports[0].Code
+}
+
+// DeliveredReceivers provides the sorted IDs of the receivers that received the message.
+func (r *OutgoingMessageRes) DeliveredReceivers() []string {
+	return r.receiversWith(func(status DeliveryStatus) bool { return status == CodeOK })
+}
+
+// OfflineReceivers provides the sorted IDs of the receivers that were offline.
+func (r *OutgoingMessageRes) OfflineReceivers() []string {
+	return r.receiversWith(func(status DeliveryStatus) bool { return status == CodeOffline })
+}
+
+// FailedReceivers provides the sorted IDs of the receivers that did not receive the message, for any reason.
+// It includes the receivers of the request that are absent from the report.
+func (r *OutgoingMessageRes) FailedReceivers() []string {
+	return r.receiversWith(func(status DeliveryStatus) bool { return status != CodeOK })
+}
+
+// Failed tells if the request failed altogether, or if the message was not delivered to some receivers.
+func (r *OutgoingMessageRes) Failed() bool {
+	return r.Code != string(CodeOK) || len(r.FailedReceivers()) > 0
+}
+
+// Err provides a *DeliveryError describing the receivers that did not receive the message.
+// It returns nil if the message was delivered to all receivers.
+func (r *OutgoingMessageRes) Err() error {
+	if r.Code != string(CodeOK) {
+		return fmt.Errorf("request failed: %s", r.Reason)
+	}
+
+	failed := r.FailedReceivers()
+	if len(failed) == 0 {
+		return nil
+	}
+
+	deliveryErr := &DeliveryError{Failures: map[string]DeliveryStatus{}}
+	for _, receiverID := range failed {
+		deliveryErr.Failures[receiverID] = r.ReceiverStatus(receiverID)
+	}
+	return deliveryErr
+}
+
+// receiversWith provides the sorted IDs of the receivers whose delivery status satisfies the given predicate.
+// The receivers of the request are included even if they are absent from the report.
+func (r *OutgoingMessageRes) receiversWith(predicate func(status DeliveryStatus) bool) []string {
+	seen := map[string]struct{}{}
+	var receiverIDs []string
+	check := func(receiverID string) {
+		if _, exists := seen[receiverID]; exists {
+			return
+		}
+		seen[receiverID] = struct{}{}
+		if predicate(r.ReceiverStatus(receiverID)) {
+			receiverIDs = append(receiverIDs, receiverID)
+		}
+	}
+
+	for _, receiverID := range r.ReceiverIDs {
+		check(receiverID)
+	}
+	for receiverID := range r.Report {
+		check(receiverID)
+	}
+
+	sort.Strings(receiverIDs)
+	return receiverIDs
+}
+
+// Error implements the error interface.
+func (e *DeliveryError) Error() string {
+	receiverIDs := make([]string, 0, len(e.Failures))
+	for receiverID := range e.Failures {
+		receiverIDs = append(receiverIDs, receiverID)
+	}
+	sort.Strings(receiverIDs)
+
+	failures := make([]string, 0, len(receiverIDs))
+	for _, receiverID := range receiverIDs {
+		failures = append(failures, fmt.Sprintf("%s (%s)", receiverID, e.Failures[receiverID]))
+	}
+
+	return fmt.Sprintf("message not delivered to %d receiver(s): %s", len(failures), strings.Join(failures, ", "))
+}
+
+// Is makes the error match the sentinel errors of all its failures.
+func (e *DeliveryError) Is(target error) bool {
+	for _, status := range e.Failures {
+		if errors.Is(status.Err(), target) {
+			return true
+		}
+	}
+	return false
+}
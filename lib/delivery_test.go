@@ -0,0 +1,182 @@
+package lib_test
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/shivanshkc/rosenbridge-cli/lib"
+)
+
+func TestOutgoingMessageRes_Receivers(t *testing.T) {
+	report := map[string][]*lib.DeliveryReport{
+		// Delivered to one of the two bridges.
+		"bob":   {{BridgeID: "b1", Code: lib.CodeBridgeNotFound}, {BridgeID: "b2", Code: lib.CodeOK}},
+		"carol": {{Code: lib.CodeOffline}},
+		"dave":  {{BridgeID: "d1", Code: lib.CodeBridgeNotFound}, {BridgeID: "d2", Code: lib.CodeOffline}},
+		"erin":  {{BridgeID: "e1", Code: lib.CodeUnknown}},
+		"frank": {},
+	}
+
+	testCases := []struct {
+		name              string
+		receiverIDs       []string
+		expectedDelivered []string
+		expectedFailed    []string
+		expectedStatus    map[string]lib.DeliveryStatus
+	}{
+		{
+			name:              "all receivers in the report",
+			expectedDelivered: []string{"bob"},
+			expectedFailed:    []string{"carol", "dave", "erin", "frank"},
+			expectedStatus: map[string]lib.DeliveryStatus{
+				"bob": lib.CodeOK, "carol": lib.CodeOffline, "dave": lib.CodeBridgeNotFound, "erin": lib.CodeUnknown,
+				"frank": lib.CodeUnknown, "grace": lib.CodeUnknown,
+			},
+		},
+		{
+			name:              "receiver absent from the report",
+			receiverIDs:       []string{"bob", "carol", "grace", "grace"},
+			expectedDelivered: []string{"bob"},
+			expectedFailed:    []string{"carol", "dave", "erin", "frank", "grace"},
+			expectedStatus:    map[string]lib.DeliveryStatus{"grace": lib.CodeUnknown},
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			response := &lib.OutgoingMessageRes{
+				Code: string(lib.CodeOK), Report: report, ReceiverIDs: testCase.receiverIDs,
+			}
+
+			if actual := response.DeliveredReceivers(); !reflect.DeepEqual(actual, testCase.expectedDelivered) {
+				t.Fatalf("expected delivered receivers %v, got %v", testCase.expectedDelivered, actual)
+			}
+			if actual := response.FailedReceivers(); !reflect.DeepEqual(actual, testCase.expectedFailed) {
+				t.Fatalf("expected failed receivers %v, got %v", testCase.expectedFailed, actual)
+			}
+			if actual := response.OfflineReceivers(); !reflect.DeepEqual(actual, []string{"carol"}) {
+				t.Fatalf("expected offline receivers [carol], got %v", actual)
+			}
+			for receiverID, expected := range testCase.expectedStatus {
+				if actual := response.ReceiverStatus(receiverID); actual != expected {
+					t.Fatalf("expected status %s for %s, got %s", expected, receiverID, actual)
+				}
+			}
+			if !response.Failed() {
+				t.Fatal("expected the response to have failed")
+			}
+		})
+	}
+}
+
+func TestOutgoingMessageRes_Failed(t *testing.T) {
+	delivered := map[string][]*lib.DeliveryReport{"bob": {{BridgeID: "b1", Code: lib.CodeOK}}}
+
+	testCases := []struct {
+		name        string
+		response    *lib.OutgoingMessageRes
+		expected    bool
+		expectedErr error
+	}{
+		{
+			name:     "delivered",
+			response: &lib.OutgoingMessageRes{Code: string(lib.CodeOK), Report: delivered},
+		},
+		{
+			name: "delivered to all receivers",
+			response: &lib.OutgoingMessageRes{
+				Code: string(lib.CodeOK), Report: delivered, ReceiverIDs: []string{"bob"},
+			},
+		},
+		{
+			name: "receiver absent from the report",
+			response: &lib.OutgoingMessageRes{
+				Code: string(lib.CodeOK), Report: delivered, ReceiverIDs: []string{"bob", "carol"},
+			},
+			expected: true, expectedErr: lib.ErrDeliveryFailed,
+		},
+		{
+			name: "empty report",
+			response: &lib.OutgoingMessageRes{
+				Code: string(lib.CodeOK), ReceiverIDs: []string{"bob"},
+			},
+			expected: true, expectedErr: lib.ErrDeliveryFailed,
+		},
+		{
+			name:     "request failed",
+			response: &lib.OutgoingMessageRes{Code: "BAD_REQUEST", Reason: "invalid receivers", Report: delivered},
+			expected: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			if actual := testCase.response.Failed(); actual != testCase.expected {
+				t.Fatalf("expected failed to be %t, got %t", testCase.expected, actual)
+			}
+
+			err := testCase.response.Err()
+			if (err != nil) != testCase.expected {
+				t.Fatalf("expected an error to be %t, got: %v", testCase.expected, err)
+			}
+			if testCase.expectedErr != nil && !errors.Is(err, testCase.expectedErr) {
+				t.Fatalf("expected the error to match %v, got: %v", testCase.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestDeliveryError_Is(t *testing.T) {
+	deliveryErr := &lib.DeliveryError{Failures: map[string]lib.DeliveryStatus{
+		"bob":   lib.CodeOffline,
+		"carol": lib.CodeBridgeNotFound,
+	}}
+
+	testCases := []struct {
+		name     string
+		err      error
+		target   error
+		expected bool
+	}{
+		{name: "offline", err: deliveryErr, target: lib.ErrReceiverOffline, expected: true},
+		{name: "bridge not found", err: deliveryErr, target: lib.ErrBridgeNotFound, expected: true},
+		{name: "not a failure", err: deliveryErr, target: lib.ErrDeliveryFailed},
+		{name: "unrelated", err: deliveryErr, target: lib.ErrConnectionClosed},
+		{name: "wrapped", err: wrap(deliveryErr), target: lib.ErrReceiverOffline, expected: true},
+		{
+			name:     "unknown code",
+			err:      &lib.DeliveryError{Failures: map[string]lib.DeliveryStatus{"bob": "SOMETHING_NEW"}},
+			target:   lib.ErrDeliveryFailed,
+			expected: true,
+		},
+		{
+			name:   "no failures",
+			err:    &lib.DeliveryError{Failures: map[string]lib.DeliveryStatus{}},
+			target: lib.ErrDeliveryFailed,
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			if actual := errors.Is(testCase.err, testCase.target); actual != testCase.expected {
+				t.Fatalf("expected errors.Is to be %t for %v, got %t", testCase.expected, testCase.target, actual)
+			}
+		})
+	}
+
+	// The failures are listed in order.
+	expected := "message not delivered to 2 receiver(s): bob (OFFLINE), carol (BRIDGE_NOT_FOUND)"
+	if deliveryErr.Error() != expected {
+		t.Fatalf("expected %q, got %q", expected, deliveryErr.Error())
+	}
+}
+
+// wrap wraps the given error like the callers usually do.
+func wrap(err error) error {
+	return fmt.Errorf("failed to send message: %w", err)
+}
@@ -0,0 +1,298 @@
+package lib
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/nacl/box"
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+// nonceSize is the size of the nonces of NaCl box and secretbox.
+const nonceSize = 24
+
+// GenerateKeyPair generates a new random key pair for the end-to-end encryption.
+func GenerateKeyPair() (*KeyPair, error) {
+	publicKey, privateKey, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key pair: %w", err)
+	}
+	return &KeyPair{PublicKey: *publicKey, PrivateKey: *privateKey}, nil
+}
+
+// ParsePublicKey parses a base64 encoded public key, like the one provided by PublicKey.String.
+func ParsePublicKey(encoded string) (PublicKey, error) {
+	var key PublicKey
+	if err := key.UnmarshalText([]byte(encoded)); err != nil {
+		return PublicKey{}, err
+	}
+	return key, nil
+}
+
+// String provides the base64 encoding of the key.
+func (k PublicKey) String() string {
+	return base64.StdEncoding.EncodeToString(k[:])
+}
+
+// MarshalText encodes the key as base64.
+func (k PublicKey) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// UnmarshalText decodes a base64 encoded key.
+func (k *PublicKey) UnmarshalText(text []byte) error {
+	return decodeKey(text, k[:])
+}
+
+// MarshalText encodes the key as base64.
+func (k PrivateKey) MarshalText() ([]byte, error) {
+	return []byte(base64.StdEncoding.EncodeToString(k[:])), nil
+}
+
+// UnmarshalText decodes a base64 encoded key.
+func (k *PrivateKey) UnmarshalText(text []byte) error {
+	return decodeKey(text, k[:])
+}
+
+// Add adds the public key of the given client to the keyring, replacing its existing key, if any.
+func (k *Keyring) Add(clientID string, key PublicKey) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if k.keys == nil {
+		k.keys = map[string]PublicKey{}
+	}
+	k.keys[clientID] = key
+}
+
+// Get provides the public key of the given client. The boolean is false if the keyring does not hold it.
+func (k *Keyring) Get(clientID string) (PublicKey, bool) {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	key, exists := k.keys[clientID]
+	return key, exists
+}
+
+// Remove removes the public key of the given client. It returns false if the keyring did not hold it.
+func (k *Keyring) Remove(clientID string) bool {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	_, exists := k.keys[clientID]
+	delete(k.keys, clientID)
+	return exists
+}
+
+// ClientIDs provides the IDs of all clients in the keyring, in sorted order.
+func (k *Keyring) ClientIDs() []string {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	clientIDs := make([]string, 0, len(k.keys))
+	for clientID := range k.keys {
+		clientIDs = append(clientIDs, clientID)
+	}
+	sort.Strings(clientIDs)
+	return clientIDs
+}
+
+// MarshalJSON encodes the keyring as a JSON object of client IDs to base64 public keys.
+func (k *Keyring) MarshalJSON() ([]byte, error) {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	keys := k.keys
+	// An empty keyring is encoded as an empty object, rather than null.
+	if keys == nil {
+		keys = map[string]PublicKey{}
+	}
+	return json.Marshal(keys)
+}
+
+// UnmarshalJSON decodes a keyring encoded by MarshalJSON, replacing all of its keys.
+func (k *Keyring) UnmarshalJSON(data []byte) error {
+	keys := map[string]PublicKey{}
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return err
+	}
+
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	k.keys = keys
+	return nil
+}
+
+// IsEncrypted tells if the given message body is encrypted end-to-end.
+func IsEncrypted(message string) bool {
+	return strings.HasPrefix(message, encryptedMessagePrefix)
+}
+
+// EncryptMessage encrypts the given message body with the key pair of the sender, so that only the holders of the
+// given public keys can decrypt it.
+//
+// The body is encrypted once with a random content key, and the content key is encrypted for every receiver, so the
+// size of the result grows only slightly with the number of receivers.
+func EncryptMessage(message string, keyPair *KeyPair, receiverKeys []PublicKey) (string, error) {
+	if len(receiverKeys) == 0 {
+		return "", errors.New("failed to encrypt message: no receiver keys")
+	}
+
+	var contentKey [32]byte
+	if _, err := io.ReadFull(rand.Reader, contentKey[:]); err != nil {
+		return "", fmt.Errorf("failed to generate content key: %w", err)
+	}
+
+	sealed := &sealedMessage{SenderKey: keyPair.PublicKey, ContentKeys: map[string][]byte{}}
+
+	// Sealing the body with the content key.
+	nonce, err := generateNonce()
+	if err != nil {
+		return "", err
+	}
+	sealed.Body = secretbox.Seal(nonce[:], []byte(message), nonce, &contentKey)
+
+	// Sealing the content key for every receiver.
+	privateKey := [32]byte(keyPair.PrivateKey)
+	for _, receiverKey := range receiverKeys {
+		nonce, err := generateNonce()
+		if err != nil {
+			return "", err
+		}
+		publicKey := [32]byte(receiverKey)
+		sealed.ContentKeys[receiverKey.String()] = box.Seal(nonce[:], contentKey[:], nonce, &publicKey, &privateKey)
+	}
+
+	sealedBytes, err := json.Marshal(sealed)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal encrypted message: %w", err)
+	}
+	return encryptedMessagePrefix + string(sealedBytes), nil
+}
+
+// DecryptMessage decrypts the given message body, which must have been encrypted for the public key of the given key
+// pair. All failures match ErrDecryptionFailed with errors.Is.
+func DecryptMessage(message string, keyPair *KeyPair) (string, error) {
+	if !IsEncrypted(message) {
+		return "", fmt.Errorf("%w: the message is not encrypted", ErrDecryptionFailed)
+	}
+
+	sealed := &sealedMessage{}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(message, encryptedMessagePrefix)), sealed); err != nil {
+		return "", fmt.Errorf("%w: malformed message: %s", ErrDecryptionFailed, err.Error())
+	}
+
+	sealedContentKey, exists := sealed.ContentKeys[keyPair.PublicKey.String()]
+	if !exists {
+		return "", fmt.Errorf("%w: the message is not encrypted for public key %s", ErrDecryptionFailed,
+			keyPair.PublicKey)
+	}
+
+	// Opening the content key, and then the body with it.
+	var contentKey [32]byte
+	senderKey, privateKey := [32]byte(sealed.SenderKey), [32]byte(keyPair.PrivateKey)
+	contentKeyBytes, isValid := openSealed(sealedContentKey, func(nonce *[nonceSize]byte, data []byte) ([]byte, bool) {
+		return box.Open(nil, data, nonce, &senderKey, &privateKey)
+	})
+	if !isValid || len(contentKeyBytes) != len(contentKey) {
+		return "", fmt.Errorf("%w: the content key is corrupted", ErrDecryptionFailed)
+	}
+
+	copy(contentKey[:], contentKeyBytes)
+	body, isValid := openSealed(sealed.Body, func(nonce *[nonceSize]byte, data []byte) ([]byte, bool) {
+		return secretbox.Open(nil, data, nonce, &contentKey)
+	})
+	if !isValid {
+		return "", fmt.Errorf("%w: the body is corrupted", ErrDecryptionFailed)
+	}
+
+	return string(body), nil
+}
+
+// encryptRequest provides a copy of the given request, with its message encrypted for all of its receivers as per the
+// encryption params. The request is returned as it is if the params do not require encryption.
+func encryptRequest(request *OutgoingMessageReq, params *EncryptionParams) (*OutgoingMessageReq, error) {
+	if params == nil || params.Keyring == nil {
+		return request, nil
+	}
+	if params.KeyPair == nil {
+		return nil, errors.New("failed to encrypt message: no key pair is configured")
+	}
+
+	receiverKeys := make([]PublicKey, 0, len(request.ReceiverIDs))
+	for _, receiverID := range request.ReceiverIDs {
+		key, exists := params.Keyring.Get(receiverID)
+		if !exists {
+			return nil, fmt.Errorf("failed to encrypt message for %s: %w", receiverID, ErrPublicKeyNotFound)
+		}
+		receiverKeys = append(receiverKeys, key)
+	}
+
+	encrypted, err := EncryptMessage(request.Message, params.KeyPair, receiverKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	requestCopy := *request
+	requestCopy.Message = encrypted
+	return &requestCopy, nil
+}
+
+// decryptIncoming decrypts the given incoming message in place as per the encryption params.
+// Messages that are not encrypted, or params that are nil, leave the message untouched.
+func decryptIncoming(message *IncomingMessageReq, params *EncryptionParams) error {
+	if params == nil || !IsEncrypted(message.Message) {
+		return nil
+	}
+	if params.KeyPair == nil {
+		return fmt.Errorf("message from %s: %w: no key pair is configured", message.SenderID, ErrDecryptionFailed)
+	}
+
+	decrypted, err := DecryptMessage(message.Message, params.KeyPair)
+	if err != nil {
+		return fmt.Errorf("message from %s: %w", message.SenderID, err)
+	}
+
+	message.Message = decrypted
+	return nil
+}
+
+// generateNonce generates a random nonce for NaCl box and secretbox.
+func generateNonce() (*[nonceSize]byte, error) {
+	var nonce [nonceSize]byte
+	if _, err := io.ReadFull(rand.Reader, nonce[:]); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return &nonce, nil
+}
+
+// openSealed splits the nonce prefix from the given sealed data, and opens the rest with the given func.
+func openSealed(sealed []byte, open func(nonce *[nonceSize]byte, data []byte) ([]byte, bool)) ([]byte, bool) {
+	if len(sealed) < nonceSize {
+		return nil, false
+	}
+
+	var nonce [nonceSize]byte
+	copy(nonce[:], sealed[:nonceSize])
+	return open(&nonce, sealed[nonceSize:])
+}
+
+// decodeKey decodes the given base64 encoded key into the given destination, which decides the expected key size.
+func decodeKey(text []byte, destination []byte) error {
+	decoded, err := base64.StdEncoding.DecodeString(string(text))
+	if err != nil {
+		return fmt.Errorf("failed to decode key: %w", err)
+	}
+	if len(decoded) != len(destination) {
+		return fmt.Errorf("invalid key size: expected %d bytes, got %d", len(destination), len(decoded))
+	}
+
+	copy(destination, decoded)
+	return nil
+}
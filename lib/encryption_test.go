@@ -0,0 +1,280 @@
+package lib
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEncryptMessage_RoundTrip(t *testing.T) {
+	sender := generateKeyPair(t)
+	receivers := []*KeyPair{generateKeyPair(t), generateKeyPair(t), generateKeyPair(t)}
+
+	receiverKeys := make([]PublicKey, 0, len(receivers))
+	for _, receiver := range receivers {
+		receiverKeys = append(receiverKeys, receiver.PublicKey)
+	}
+
+	encrypted, err := EncryptMessage("hello there", sender, receiverKeys)
+	if err != nil {
+		t.Fatalf("failed to encrypt message: %v", err)
+	}
+	if !IsEncrypted(encrypted) || strings.Contains(encrypted, "hello there") {
+		t.Fatalf("expected an encrypted message, got: %s", encrypted)
+	}
+
+	// Every receiver can read the message.
+	for i, receiver := range receivers {
+		decrypted, err := DecryptMessage(encrypted, receiver)
+		if err != nil {
+			t.Fatalf("receiver %d failed to decrypt message: %v", i, err)
+		}
+		if decrypted != "hello there" {
+			t.Fatalf("receiver %d expected %q, got %q", i, "hello there", decrypted)
+		}
+	}
+
+	// No receivers means nobody could read the message.
+	if _, err := EncryptMessage("hello there", sender, nil); err == nil {
+		t.Fatal("expected an error for no receiver keys, got nil")
+	}
+}
+
+func TestDecryptMessage_Failures(t *testing.T) {
+	sender, receiver := generateKeyPair(t), generateKeyPair(t)
+
+	encrypted, err := EncryptMessage("hello there", sender, []PublicKey{receiver.PublicKey})
+	if err != nil {
+		t.Fatalf("failed to encrypt message: %v", err)
+	}
+
+	testCases := []struct {
+		name    string
+		message string
+		keyPair *KeyPair
+	}{
+		{name: "not a recipient", message: encrypted, keyPair: generateKeyPair(t)},
+		{name: "not encrypted", message: "hello there", keyPair: receiver},
+		{name: "malformed", message: encryptedMessagePrefix + "{not json", keyPair: receiver},
+		{
+			name: "tampered body", keyPair: receiver,
+			message: tamper(t, encrypted, func(sealed *sealedMessage) { sealed.Body[len(sealed.Body)-1] ^= 1 }),
+		},
+		{
+			name: "truncated body", keyPair: receiver,
+			message: tamper(t, encrypted, func(sealed *sealedMessage) { sealed.Body = sealed.Body[:nonceSize-1] }),
+		},
+		{
+			name: "tampered content key", keyPair: receiver,
+			message: tamper(t, encrypted, func(sealed *sealedMessage) {
+				contentKey := sealed.ContentKeys[receiver.PublicKey.String()]
+				contentKey[len(contentKey)-1] ^= 1
+			}),
+		},
+		{
+			name: "replaced sender key", keyPair: receiver,
+			message: tamper(t, encrypted, func(sealed *sealedMessage) {
+				sealed.SenderKey = generateKeyPair(t).PublicKey
+			}),
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			decrypted, err := DecryptMessage(testCase.message, testCase.keyPair)
+			if !errors.Is(err, ErrDecryptionFailed) {
+				t.Fatalf("expected ErrDecryptionFailed, got: %v", err)
+			}
+			if decrypted != "" {
+				t.Fatalf("expected no message, got %q", decrypted)
+			}
+		})
+	}
+}
+
+func TestEncryptRequest(t *testing.T) {
+	sender, bob, carol := generateKeyPair(t), generateKeyPair(t), generateKeyPair(t)
+
+	keyring := &Keyring{}
+	keyring.Add("bob", bob.PublicKey)
+	keyring.Add("carol", carol.PublicKey)
+
+	testCases := []struct {
+		name        string
+		params      *EncryptionParams
+		receiverIDs []string
+		encrypted   bool
+		expectedErr error
+	}{
+		{name: "nil params", receiverIDs: []string{"bob"}},
+		{name: "no keyring", params: &EncryptionParams{KeyPair: sender}, receiverIDs: []string{"bob"}},
+		{
+			name: "all receivers known", params: &EncryptionParams{KeyPair: sender, Keyring: keyring},
+			receiverIDs: []string{"bob", "carol"}, encrypted: true,
+		},
+		{
+			name: "receiver not in keyring", params: &EncryptionParams{KeyPair: sender, Keyring: keyring},
+			receiverIDs: []string{"bob", "dave"}, expectedErr: ErrPublicKeyNotFound,
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			request := &OutgoingMessageReq{Message: "hello there", ReceiverIDs: testCase.receiverIDs}
+			encrypted, err := encryptRequest(request, testCase.params)
+			if !errors.Is(err, testCase.expectedErr) {
+				t.Fatalf("expected error %v, got: %v", testCase.expectedErr, err)
+			}
+			if err != nil {
+				return
+			}
+
+			// The request of the caller is never modified.
+			if request.Message != "hello there" {
+				t.Fatalf("expected the original request to be untouched, got: %s", request.Message)
+			}
+			if IsEncrypted(encrypted.Message) != testCase.encrypted {
+				t.Fatalf("expected encrypted to be %t, got message: %s", testCase.encrypted, encrypted.Message)
+			}
+		})
+	}
+
+	// The encrypted request can be read back by every receiver.
+	encrypted, err := encryptRequest(&OutgoingMessageReq{Message: "hello there", ReceiverIDs: []string{"bob", "carol"}},
+		&EncryptionParams{KeyPair: sender, Keyring: keyring})
+	if err != nil {
+		t.Fatalf("failed to encrypt request: %v", err)
+	}
+	for _, receiver := range []*KeyPair{bob, carol} {
+		message := &IncomingMessageReq{SenderID: "alice", Message: encrypted.Message}
+		if err := decryptIncoming(message, &EncryptionParams{KeyPair: receiver}); err != nil {
+			t.Fatalf("failed to decrypt incoming message: %v", err)
+		}
+		if message.Message != "hello there" {
+			t.Fatalf("expected %q, got %q", "hello there", message.Message)
+		}
+	}
+
+	// A key pair is required to encrypt.
+	_, err = encryptRequest(&OutgoingMessageReq{Message: "hello there", ReceiverIDs: []string{"bob"}},
+		&EncryptionParams{Keyring: keyring})
+	if err == nil {
+		t.Fatal("expected an error for no key pair, got nil")
+	}
+}
+
+func TestDecryptIncoming(t *testing.T) {
+	sender, receiver := generateKeyPair(t), generateKeyPair(t)
+
+	encrypted, err := EncryptMessage("hello there", sender, []PublicKey{receiver.PublicKey})
+	if err != nil {
+		t.Fatalf("failed to encrypt message: %v", err)
+	}
+
+	testCases := []struct {
+		name        string
+		message     string
+		params      *EncryptionParams
+		expected    string
+		expectedErr error
+	}{
+		{name: "plain message", message: "hello", params: &EncryptionParams{KeyPair: receiver}, expected: "hello"},
+		{name: "nil params", message: encrypted, expected: encrypted},
+		{
+			name: "encrypted message", message: encrypted, params: &EncryptionParams{KeyPair: receiver},
+			expected: "hello there",
+		},
+		{
+			name: "no key pair", message: encrypted, params: &EncryptionParams{}, expected: encrypted,
+			expectedErr: ErrDecryptionFailed,
+		},
+		{
+			name: "not a recipient", message: encrypted, params: &EncryptionParams{KeyPair: sender},
+			expected: encrypted, expectedErr: ErrDecryptionFailed,
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			message := &IncomingMessageReq{SenderID: "alice", Message: testCase.message}
+			err := decryptIncoming(message, testCase.params)
+			if !errors.Is(err, testCase.expectedErr) {
+				t.Fatalf("expected error %v, got: %v", testCase.expectedErr, err)
+			}
+			if message.Message != testCase.expected {
+				t.Fatalf("expected message %q, got %q", testCase.expected, message.Message)
+			}
+		})
+	}
+}
+
+func TestKeyring_JSON(t *testing.T) {
+	bob, carol := generateKeyPair(t), generateKeyPair(t)
+
+	keyring := &Keyring{}
+	keyring.Add("bob", bob.PublicKey)
+	keyring.Add("carol", carol.PublicKey)
+
+	encoded, err := json.Marshal(keyring)
+	if err != nil {
+		t.Fatalf("failed to marshal keyring: %v", err)
+	}
+
+	// Decoding replaces all the existing keys.
+	decoded := &Keyring{}
+	decoded.Add("dave", generateKeyPair(t).PublicKey)
+	if err := json.Unmarshal(encoded, decoded); err != nil {
+		t.Fatalf("failed to unmarshal keyring: %v", err)
+	}
+
+	if clientIDs := decoded.ClientIDs(); len(clientIDs) != 2 || clientIDs[0] != "bob" || clientIDs[1] != "carol" {
+		t.Fatalf("expected bob and carol, got: %v", clientIDs)
+	}
+	for clientID, expected := range map[string]PublicKey{"bob": bob.PublicKey, "carol": carol.PublicKey} {
+		if key, _ := decoded.Get(clientID); key != expected {
+			t.Fatalf("expected key %s for %s, got %s", expected, clientID, key)
+		}
+	}
+
+	// An empty keyring is an empty object.
+	if encoded, _ := json.Marshal(&Keyring{}); string(encoded) != "{}" {
+		t.Fatalf("expected {}, got %s", encoded)
+	}
+
+	// Invalid keys are rejected.
+	if err := json.Unmarshal([]byte(`{"bob": "not-a-key"}`), &Keyring{}); err == nil {
+		t.Fatal("expected an error for an invalid key, got nil")
+	}
+}
+
+// generateKeyPair generates a new key pair, failing the test upon errors.
+func generateKeyPair(t *testing.T) *KeyPair {
+	t.Helper()
+
+	keyPair, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("failed to generate key pair: %v", err)
+	}
+	return keyPair
+}
+
+// tamper decodes the given encrypted message, modifies it with the given func, and encodes it again.
+func tamper(t *testing.T, message string, modify func(sealed *sealedMessage)) string {
+	t.Helper()
+
+	sealed := &sealedMessage{}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(message, encryptedMessagePrefix)), sealed); err != nil {
+		t.Fatalf("failed to decode encrypted message: %v", err)
+	}
+	modify(sealed)
+
+	sealedBytes, err := json.Marshal(sealed)
+	if err != nil {
+		t.Fatalf("failed to encode encrypted message: %v", err)
+	}
+	return encryptedMessagePrefix + string(sealedBytes)
+}
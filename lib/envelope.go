@@ -0,0 +1,130 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// NewTextMessage creates a new envelope with the given plain text body.
+func NewTextMessage(text string) *Envelope {
+	// Marshalling a string never fails.
+	body, _ := json.Marshal(text)
+	return newEnvelope(ContentTypeText, body)
+}
+
+// NewJSONMessage creates a new envelope with the JSON encoding of the given value as its body.
+func NewJSONMessage(value interface{}) (*Envelope, error) {
+	body, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal body: %w", err)
+	}
+	return newEnvelope(ContentTypeJSON, body), nil
+}
+
+// ParseEnvelope parses the given message body as an envelope.
+//
+// Bodies without an envelope are legacy messages, for which an envelope of Version zero is provided, with the whole
+// body as its text. It fails with ErrInvalidEnvelope if the body is marked as an envelope but cannot be parsed, or if
+// its version is newer than EnvelopeVersion.
+func ParseEnvelope(message string) (*Envelope, error) {
+	if !IsEnvelope(message) {
+		body, _ := json.Marshal(message)
+		return &Envelope{ContentType: ContentTypeText, Body: body}, nil
+	}
+
+	envelope := &Envelope{}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(message, envelopePrefix)), envelope); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidEnvelope, err.Error())
+	}
+	if envelope.Version < 1 || envelope.Version > EnvelopeVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidEnvelope, envelope.Version)
+	}
+	if len(envelope.Body) == 0 {
+		return nil, fmt.Errorf("%w: no body", ErrInvalidEnvelope)
+	}
+
+	return envelope, nil
+}
+
+// IsEnvelope tells if the given message body is an envelope.
+func IsEnvelope(message string) bool {
+	return strings.HasPrefix(message, envelopePrefix)
+}
+
+// Envelope parses the message body as an envelope. See ParseEnvelope.
+func (m *IncomingMessageReq) Envelope() (*Envelope, error) {
+	return ParseEnvelope(m.Message)
+}
+
+// Encode provides the envelope in the form of a message body, to be used as the Message of an OutgoingMessageReq.
+func (e *Envelope) Encode() (string, error) {
+	if len(e.Body) == 0 {
+		return "", fmt.Errorf("%w: no body", ErrInvalidEnvelope)
+	}
+
+	// Legacy envelopes are encoded as the plain text bodies they came from.
+	if e.IsLegacy() {
+		return e.Text(), nil
+	}
+
+	envelopeBytes, err := json.Marshal(e)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal envelope: %w", err)
+	}
+	return envelopePrefix + string(envelopeBytes), nil
+}
+
+// IsLegacy tells if the envelope belongs to a legacy message, that is, a plain text body without an envelope.
+func (e *Envelope) IsLegacy() bool {
+	return e.Version == 0
+}
+
+// IsJSON tells if the content type of the envelope is JSON, like "application/json" or "application/problem+json".
+func (e *Envelope) IsJSON() bool {
+	mediaType, _, err := mime.ParseMediaType(e.ContentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == ContentTypeJSON || strings.HasSuffix(mediaType, "+json")
+}
+
+// Text provides the body as text. JSON bodies are provided as their JSON encoding.
+func (e *Envelope) Text() string {
+	var text string
+	if !e.IsJSON() && json.Unmarshal(e.Body, &text) == nil {
+		return text
+	}
+	return string(e.Body)
+}
+
+// DecodeJSON decodes the JSON body into the given value, like json.Unmarshal.
+//
+// If the content type is not JSON, the text of the body is decoded instead, so the legacy messages that carry JSON as
+// plain text can be decoded as well.
+func (e *Envelope) DecodeJSON(value interface{}) error {
+	body := []byte(e.Body)
+	if !e.IsJSON() {
+		body = []byte(e.Text())
+	}
+
+	if err := json.Unmarshal(body, value); err != nil {
+		return fmt.Errorf("failed to decode body: %w", err)
+	}
+	return nil
+}
+
+// newEnvelope creates a new envelope of the current version, with the given content type and JSON encoded body.
+func newEnvelope(contentType string, body json.RawMessage) *Envelope {
+	return &Envelope{
+		Version:     EnvelopeVersion,
+		ContentType: contentType,
+		Timestamp:   time.Now().UTC(),
+		MessageID:   uuid.NewString(),
+		Body:        body,
+	}
+}
@@ -3,8 +3,18 @@ package lib
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/fatih/color"
 )
@@ -16,6 +26,9 @@ func DefaultIncomingMessageHandler(ctx context.Context, message *IncomingMessage
 func DefaultOutgoingMessageResponseHandler(ctx context.Context, response *OutgoingMessageRes, err error) {
 }
 
+// DefaultConnectionEventHandler is the default handler for connection lifecycle events.
+func DefaultConnectionEventHandler(ctx context.Context, event *ConnectionEvent) {}
+
 // DefaultConnectionClosureHandler is the default handler for connection closures.
 func DefaultConnectionClosureHandler(ctx context.Context, err interface{}) {
 	if err != nil {
@@ -23,20 +36,202 @@ func DefaultConnectionClosureHandler(ctx context.Context, err interface{}) {
 	}
 }
 
-// getWebsocketProtocol provides the correct websocket protocol based on the connection params.
-func getWebsocketProtocol(params *ConnectionParams) string {
-	if params.IsTLSEnabled {
-		return "wss"
+// backoffDelay calculates the delay before the given attempt using exponential backoff with jitter.
+// The attempt number starts from 1. Zero (or invalid) values of the params are replaced with the defaults.
+func backoffDelay(initial, maxDelay time.Duration, multiplier, jitter float64, attempt int) time.Duration {
+	// Replacing the unset values with the defaults.
+	if initial <= 0 {
+		initial = defaultInitialBackoff
+	}
+	if maxDelay <= 0 {
+		maxDelay = defaultMaxBackoff
+	}
+	if multiplier < 1 {
+		multiplier = defaultMultiplier
+	}
+	if jitter <= 0 || jitter > 1 {
+		jitter = defaultJitter
+	}
+
+	// Growing the delay exponentially and capping it.
+	delay := math.Min(float64(initial)*math.Pow(multiplier, float64(attempt-1)), float64(maxDelay))
+	// Randomizing the delay within the range [delay*(1-jitter), delay*(1+jitter)].
+	delay += delay * jitter * (2*rand.Float64() - 1) //nolint:gosec // Cryptographic randomness is not required.
+
+	return time.Duration(delay)
+}
+
+// DefaultIsRetryable is the default classifier of retryable errors used by the RetryPolicy.
+//
+// It retries the 429, 502, 503 and 504 HTTP errors, and the transient network errors, which are the timeouts, the
+// temporary errors and the connections reset or closed by the peer. Context cancellations and all other errors, like
+// the TLS verification failures or an invalid proxy, are not retried.
+func DefaultIsRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout:
+			return true
+		default:
+			return false
+		}
 	}
-	return "ws"
+
+	return isTransientNetworkError(err)
 }
 
-// getHTTPProtocol provides the correct http protocol based on the connection params.
-func getHTTPProtocol(params *ConnectionParams) string {
-	if params.IsTLSEnabled {
-		return "https"
+// isTransientNetworkError tells if the given error is a network failure that may not occur upon the next attempt.
+func isTransientNetworkError(err error) bool {
+	// A connection that breaks in the middle of an exchange is worth another one.
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNABORTED) || errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	// The HTTP client reports a connection closed by the server before the response as io.EOF.
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) && errors.Is(urlErr.Err, io.EOF) {
+		return true
+	}
+
+	// The *url.Error is a net.Error too, which passes on the behaviour of the error that it wraps.
+	var netErr net.Error
+	if !errors.As(err, &netErr) {
+		return false
 	}
-	return "http"
+	if netErr.Timeout() {
+		return true
+	}
+	temporaryErr, isTemporary := netErr.(interface{ Temporary() bool })
+	return isTemporary && temporaryErr.Temporary()
+}
+
+// parseRetryAfter parses the value of the Retry-After header, which can be a number of seconds or an HTTP date.
+// It returns zero if the value is absent or invalid.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+
+	return 0
+}
+
+// ParseEndpoint parses the given base URL of a Rosenbridge deployment, like "https://gw.example.com/rosen/", for use
+// as the ConnectionParams.Endpoint. The scheme must be one of http, https, ws or wss.
+func ParseEndpoint(rawURL string) (*url.URL, error) {
+	endpoint, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse endpoint: %w", err)
+	}
+	if err := validateEndpoint(endpoint); err != nil {
+		return nil, err
+	}
+	return endpoint, nil
+}
+
+// validateEndpoint checks if the given endpoint is usable as the base URL of a Rosenbridge deployment.
+func validateEndpoint(endpoint *url.URL) error {
+	switch endpoint.Scheme {
+	case "http", "https", "ws", "wss":
+	default:
+		return fmt.Errorf("%w: scheme must be one of http, https, ws or wss, got %q", ErrInvalidEndpoint,
+			endpoint.Scheme)
+	}
+	if endpoint.Host == "" {
+		return fmt.Errorf("%w: host is missing", ErrInvalidEndpoint)
+	}
+	return nil
+}
+
+// getBaseEndpoint provides a copy of the base URL of the deployment as per the connection params.
+//
+// It is the Endpoint if set, otherwise it is built from the deprecated BaseURL and IsTLSEnabled fields.
+// The path of the returned URL always ends with a slash, so the API paths can be resolved against it.
+func getBaseEndpoint(params *ConnectionParams) (*url.URL, error) {
+	var base url.URL
+	if params.Endpoint != nil {
+		base = *params.Endpoint
+	} else {
+		scheme := "http"
+		if params.IsTLSEnabled {
+			scheme = "https"
+		}
+		parsed, err := url.Parse(scheme + "://" + params.BaseURL)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to parse base url: %s", ErrInvalidEndpoint, err.Error())
+		}
+		base = *parsed
+	}
+
+	if err := validateEndpoint(&base); err != nil {
+		return nil, err
+	}
+
+	// Without the trailing slash, the last segment of the path prefix would be replaced upon resolution.
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+		if base.RawPath != "" {
+			base.RawPath += "/"
+		}
+	}
+	return &base, nil
+}
+
+// getHTTPEndpoint provides the URL of the given HTTP API path, like "api/message", as per the connection params.
+func getHTTPEndpoint(params *ConnectionParams, path string) (*url.URL, error) {
+	base, err := getBaseEndpoint(params)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := base.ResolveReference(&url.URL{Path: path})
+	// The query params of the base (if any) are preserved.
+	endpoint.RawQuery = base.RawQuery
+
+	switch endpoint.Scheme {
+	case "ws":
+		endpoint.Scheme = "http"
+	case "wss":
+		endpoint.Scheme = "https"
+	}
+	return endpoint, nil
+}
+
+// getWebsocketEndpoint provides the URL for establishing a bridge as per the connection params.
+// The client ID is escaped properly in the query string.
+func getWebsocketEndpoint(params *ConnectionParams) (*url.URL, error) {
+	base, err := getBaseEndpoint(params)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := base.ResolveReference(&url.URL{Path: "api/bridge"})
+	switch endpoint.Scheme {
+	case "http":
+		endpoint.Scheme = "ws"
+	case "https":
+		endpoint.Scheme = "wss"
+	}
+
+	// The query params of the base (if any) are preserved.
+	query := base.Query()
+	query.Set("client_id", params.ClientID)
+	endpoint.RawQuery = query.Encode()
+
+	return endpoint, nil
 }
 
 // anyToBytes converts the provided input to a byte slice.
@@ -87,3 +282,34 @@ func anyToAny(input interface{}, targetOutput interface{}) error {
 func isCode2xx(statusCode int) bool {
 	return statusCode/100 == 2 //nolint:gomnd // These are not magic numbers.
 }
+
+// prepareRequest provides the given request in the form it is to be sent as per the params, that is, signed and then
+// encrypted. The given request is never modified.
+func prepareRequest(request *OutgoingMessageReq, params *ConnectionParams) (*OutgoingMessageReq, error) {
+	request, err := signRequest(request, params.ClientID, params.Signing)
+	if err != nil {
+		return nil, err
+	}
+	return encryptRequest(request, params.Encryption)
+}
+
+// openIncoming decrypts and then verifies the given incoming message in place, as per the params.
+// It returns false if the message is to be dropped.
+func openIncoming(message *IncomingMessageReq, params *ConnectionParams) (bool, error) {
+	if err := decryptIncoming(message, params.Encryption); err != nil {
+		return false, err
+	}
+
+	signing := params.Signing
+	if signing == nil || signing.TrustStore == nil {
+		return true, nil
+	}
+
+	maxAge := signing.MaxAge
+	if maxAge == 0 {
+		maxAge = defaultSignatureMaxAge
+	}
+
+	VerifyMessage(message, params.ClientID, signing.TrustStore, maxAge)
+	return !signing.DropUnverified || message.Verification == VerificationVerified, nil
+}
@@ -0,0 +1,285 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestDefaultIsRetryable(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{name: "too many requests", err: &StatusError{StatusCode: http.StatusTooManyRequests}, expected: true},
+		{name: "bad gateway", err: &StatusError{StatusCode: http.StatusBadGateway}, expected: true},
+		{name: "service unavailable", err: &StatusError{StatusCode: http.StatusServiceUnavailable}, expected: true},
+		{name: "gateway timeout", err: &StatusError{StatusCode: http.StatusGatewayTimeout}, expected: true},
+		{name: "wrapped status", err: fmt.Errorf("failed: %w", &StatusError{StatusCode: 503}), expected: true},
+		{name: "bad request", err: &StatusError{StatusCode: http.StatusBadRequest}},
+		{name: "internal server error", err: &StatusError{StatusCode: http.StatusInternalServerError}},
+		{name: "canceled", err: context.Canceled},
+		{name: "deadline exceeded", err: fmt.Errorf("failed: %w", context.DeadlineExceeded)},
+		{name: "plain error", err: errors.New("failed")},
+		{name: "connection reset", err: urlError(syscallError(syscall.ECONNRESET)), expected: true},
+		{name: "broken pipe", err: urlError(syscallError(syscall.EPIPE)), expected: true},
+		{name: "closed before response", err: urlError(io.EOF), expected: true},
+		{name: "unexpected eof", err: urlError(io.ErrUnexpectedEOF), expected: true},
+		{name: "temporary dns failure", err: urlError(&net.DNSError{IsTemporary: true}), expected: true},
+		{name: "dns timeout", err: urlError(&net.DNSError{IsTimeout: true}), expected: true},
+		{name: "unknown host", err: urlError(&net.DNSError{IsNotFound: true})},
+		{name: "connection refused", err: urlError(syscallError(syscall.ECONNREFUSED))},
+		{name: "unsupported scheme", err: requestError(t, http.DefaultClient, "ftp://localhost")},
+		{name: "untrusted certificate", err: untrustedCertificateError(t)},
+		{name: "read timeout", err: urlError(&net.OpError{Op: "read", Err: os.ErrDeadlineExceeded}), expected: true},
+		{name: "dial timeout", err: &net.OpError{Op: "dial", Err: os.ErrDeadlineExceeded}, expected: true},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			if actual := DefaultIsRetryable(testCase.err); actual != testCase.expected {
+				t.Fatalf("expected %t for %v, got %t", testCase.expected, testCase.err, actual)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name     string
+		value    string
+		expected time.Duration
+	}{
+		{name: "absent"},
+		{name: "seconds", value: "120", expected: 2 * time.Minute},
+		{name: "zero seconds", value: "0"},
+		{name: "negative seconds", value: "-5"},
+		{name: "http date", value: now.Add(90 * time.Second).Format(http.TimeFormat), expected: 90 * time.Second},
+		{name: "past http date", value: now.Add(-time.Minute).Format(http.TimeFormat)},
+		{name: "invalid", value: "soon"},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			if actual := parseRetryAfter(testCase.value, now); actual != testCase.expected {
+				t.Fatalf("expected %s, got %s", testCase.expected, actual)
+			}
+		})
+	}
+}
+
+// urlError wraps the given error like the HTTP client does.
+func urlError(err error) error {
+	return &url.Error{Op: "Post", URL: "http://localhost/api/message", Err: err}
+}
+
+// syscallError wraps the given errno like the network operations do.
+func syscallError(errno syscall.Errno) error {
+	return &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", errno)}
+}
+
+// requestError provides the error of a GET request to the given URL using the given client.
+func requestError(t *testing.T, client *http.Client, rawURL string) error {
+	t.Helper()
+
+	response, err := client.Get(rawURL) //nolint:noctx // The tests need the error only.
+	if err == nil {
+		_ = response.Body.Close()
+		t.Fatalf("expected the request to %s to fail", rawURL)
+	}
+	return err
+}
+
+// untrustedCertificateError provides the error of a request to a TLS server whose certificate is not trusted.
+func untrustedCertificateError(t *testing.T) error {
+	t.Helper()
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	// The server logs the failed handshake, which is expected here.
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+
+	return requestError(t, &http.Client{}, server.URL)
+}
+
+func TestGetHTTPEndpoint(t *testing.T) {
+	testCases := []struct {
+		name     string
+		params   *ConnectionParams
+		expected string
+	}{
+		{
+			name: "no path", params: endpointParams(t, "https://gw.example.com"),
+			expected: "https://gw.example.com/api/message",
+		},
+		{
+			name: "prefix without slash", params: endpointParams(t, "https://gw.example.com/rosen"),
+			expected: "https://gw.example.com/rosen/api/message",
+		},
+		{
+			name: "prefix with slash", params: endpointParams(t, "http://gw.example.com:8080/a/rosen/"),
+			expected: "http://gw.example.com:8080/a/rosen/api/message",
+		},
+		{
+			name: "websocket scheme", params: endpointParams(t, "ws://gw.example.com/rosen"),
+			expected: "http://gw.example.com/rosen/api/message",
+		},
+		{
+			name: "secure websocket scheme", params: endpointParams(t, "wss://gw.example.com"),
+			expected: "https://gw.example.com/api/message",
+		},
+		{
+			name: "base query", params: endpointParams(t, "https://gw.example.com/rosen/?key=a%26b&region=eu"),
+			expected: "https://gw.example.com/rosen/api/message?key=a%26b&region=eu",
+		},
+		{
+			name: "escaped prefix", params: endpointParams(t, "https://gw.example.com/my%2Frosen"),
+			expected: "https://gw.example.com/my%2Frosen/api/message",
+		},
+		{
+			name: "base url", params: &ConnectionParams{BaseURL: "localhost:8080"},
+			expected: "http://localhost:8080/api/message",
+		},
+		{
+			name: "base url with tls", params: &ConnectionParams{BaseURL: "gw.example.com", IsTLSEnabled: true},
+			expected: "https://gw.example.com/api/message",
+		},
+		{
+			name: "endpoint over base url", params: &ConnectionParams{
+				Endpoint: endpointParams(t, "https://gw.example.com/rosen").Endpoint, BaseURL: "localhost:8080",
+			},
+			expected: "https://gw.example.com/rosen/api/message",
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			endpoint, err := getHTTPEndpoint(testCase.params, "api/message")
+			if err != nil {
+				t.Fatalf("failed to get endpoint: %v", err)
+			}
+			if endpoint.String() != testCase.expected {
+				t.Fatalf("expected %s, got %s", testCase.expected, endpoint)
+			}
+		})
+	}
+}
+
+func TestGetWebsocketEndpoint(t *testing.T) {
+	testCases := []struct {
+		name     string
+		params   *ConnectionParams
+		expected string
+	}{
+		{
+			name: "http scheme", params: endpointParams(t, "http://gw.example.com"),
+			expected: "ws://gw.example.com/api/bridge?client_id=alice",
+		},
+		{
+			name: "https scheme", params: endpointParams(t, "https://gw.example.com/rosen"),
+			expected: "wss://gw.example.com/rosen/api/bridge?client_id=alice",
+		},
+		{
+			name: "websocket scheme", params: endpointParams(t, "ws://gw.example.com:8080/rosen/"),
+			expected: "ws://gw.example.com:8080/rosen/api/bridge?client_id=alice",
+		},
+		{
+			name: "base query", params: endpointParams(t, "wss://gw.example.com/?region=eu"),
+			expected: "wss://gw.example.com/api/bridge?client_id=alice&region=eu",
+		},
+		{
+			name: "client id in base query", params: endpointParams(t, "wss://gw.example.com/?client_id=mallory"),
+			expected: "wss://gw.example.com/api/bridge?client_id=alice",
+		},
+		{
+			name: "escaped client id", params: &ConnectionParams{
+				ClientID: "a&b=c d", Endpoint: endpointParams(t, "https://gw.example.com").Endpoint,
+			},
+			expected: "wss://gw.example.com/api/bridge?client_id=a%26b%3Dc+d",
+		},
+		{
+			name: "base url", params: &ConnectionParams{ClientID: "alice", BaseURL: "localhost:8080"},
+			expected: "ws://localhost:8080/api/bridge?client_id=alice",
+		},
+		{
+			name: "base url with tls", params: &ConnectionParams{
+				ClientID: "alice", BaseURL: "gw.example.com", IsTLSEnabled: true,
+			},
+			expected: "wss://gw.example.com/api/bridge?client_id=alice",
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			if testCase.params.ClientID == "" {
+				testCase.params.ClientID = "alice"
+			}
+			endpoint, err := getWebsocketEndpoint(testCase.params)
+			if err != nil {
+				t.Fatalf("failed to get endpoint: %v", err)
+			}
+			if endpoint.String() != testCase.expected {
+				t.Fatalf("expected %s, got %s", testCase.expected, endpoint)
+			}
+		})
+	}
+}
+
+func TestGetBaseEndpoint_Invalid(t *testing.T) {
+	testCases := []struct {
+		name   string
+		params *ConnectionParams
+	}{
+		{name: "unsupported scheme", params: &ConnectionParams{Endpoint: &url.URL{Scheme: "ftp", Host: "gw.example.com"}}},
+		{name: "missing host", params: &ConnectionParams{Endpoint: &url.URL{Scheme: "https", Path: "/rosen"}}},
+		{name: "empty base url", params: &ConnectionParams{}},
+		{name: "invalid base url", params: &ConnectionParams{BaseURL: "gw.example.com:port"}},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			if _, err := getBaseEndpoint(testCase.params); !errors.Is(err, ErrInvalidEndpoint) {
+				t.Fatalf("expected ErrInvalidEndpoint, got: %v", err)
+			}
+		})
+	}
+
+	// The params are never modified.
+	endpoint := endpointParams(t, "https://gw.example.com/rosen").Endpoint
+	if _, err := getBaseEndpoint(&ConnectionParams{Endpoint: endpoint}); err != nil {
+		t.Fatalf("failed to get endpoint: %v", err)
+	}
+	if endpoint.Path != "/rosen" {
+		t.Fatalf("expected the endpoint to be untouched, got path %s", endpoint.Path)
+	}
+}
+
+// endpointParams provides the connection params with the given endpoint.
+func endpointParams(t *testing.T, rawURL string) *ConnectionParams {
+	t.Helper()
+
+	endpoint, err := ParseEndpoint(rawURL)
+	if err != nil {
+		t.Fatalf("failed to parse endpoint: %v", err)
+	}
+	return &ConnectionParams{Endpoint: endpoint}
+}
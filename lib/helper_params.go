@@ -2,6 +2,7 @@ package lib
 
 import (
 	"errors"
+	"time"
 )
 
 // Types of data sent/received over the connection to/from Rosenbridge.
@@ -12,16 +13,126 @@ const (
 	typeErrorRes           string = "ERROR_RES"
 )
 
+// Codes used by Rosenbridge in responses and delivery reports.
 const (
-	// codeOK is the success code for all scenarios.
-	codeOK = "OK"
-	// codeOffline indicates that the concerned client is offline.
-	codeOffline = "OFFLINE" //nolint:unused
-	// codeBridgeNotFound is sent when the required bridge does not exist.
-	codeBridgeNotFound = "BRIDGE_NOT_FOUND" //nolint:unused
-	// codeUnknown indicates that an unknown error occurred.
-	codeUnknown = "UNKNOWN" //nolint:unused
+	// CodeOK is the success code for all scenarios.
+	CodeOK DeliveryStatus = "OK"
+	// CodeOffline indicates that the concerned client is offline.
+	CodeOffline DeliveryStatus = "OFFLINE"
+	// CodeBridgeNotFound is sent when the required bridge does not exist.
+	CodeBridgeNotFound DeliveryStatus = "BRIDGE_NOT_FOUND"
+	// CodeUnknown indicates that an unknown error occurred.
+	CodeUnknown DeliveryStatus = "UNKNOWN"
+)
+
+// Lifecycle events of a connection.
+const (
+	// EventReconnecting is emitted before every redial attempt.
+	EventReconnecting ConnectionEventType = "RECONNECTING"
+	// EventReconnected is emitted when a redial attempt succeeds.
+	EventReconnected ConnectionEventType = "RECONNECTED"
+)
+
+// Policies for event channels that are full.
+const (
+	// OverflowBlock makes the connection wait until the channel has room. It stops reading from Rosenbridge meanwhile,
+	// like a slow IncomingMessageHandlerFunc does, so the channel should be consumed promptly.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest discards the event that is being delivered.
+	OverflowDropNewest
+	// OverflowDropOldest discards the oldest event in the channel to make room for the new one.
+	OverflowDropOldest
+)
+
+// Default values for the ReconnectParams.
+const (
+	defaultInitialBackoff = 500 * time.Millisecond
+	defaultMaxBackoff     = 30 * time.Second
+	defaultMultiplier     = 2
+	defaultJitter         = 0.2
+)
+
+// defaultPongTimeout is the default value of ConnectionParams.PongTimeout.
+const defaultPongTimeout = 10 * time.Second
+
+// defaultSendQueueSize is the default value of ConnectionParams.SendQueueSize.
+const defaultSendQueueSize = 64
+
+// defaultSignatureMaxAge is the default value of SigningParams.MaxAge.
+const defaultSignatureMaxAge = 5 * time.Minute
+
+// writeTimeout is the maximum time a single frame can take to be written to the connection.
+const writeTimeout = 10 * time.Second
+
+// closeHandshakeTimeout is the time for which a closing connection waits for Rosenbridge to acknowledge the closure.
+const closeHandshakeTimeout = 3 * time.Second
+
+// encryptedMessagePrefix marks the message bodies that are encrypted end-to-end.
+const encryptedMessagePrefix = "rosen-e2e.v1:"
+
+// signedMessagePrefix marks the message bodies that are signed by their senders.
+const signedMessagePrefix = "rosen-sig.v1:"
+
+// Verification results of the incoming messages.
+const (
+	// VerificationVerified means that the message is signed by the trusted key of its sender, for this receiver.
+	VerificationVerified Verification = "verified"
+	// VerificationUnverified means that the message is not signed, or its sender is not in the trust store.
+	VerificationUnverified Verification = "unverified"
+	// VerificationForged means that the message claims to be signed by its sender, but the signature is invalid, was
+	// made for another sender or receiver, or is too old.
+	VerificationForged Verification = "forged"
+)
+
+// envelopePrefix marks the message bodies that are envelopes.
+const envelopePrefix = "rosen-envelope:"
+
+// EnvelopeVersion is the version of the envelopes created by this package.
+const EnvelopeVersion = 1
+
+// Common content types of the envelopes.
+const (
+	// ContentTypeText is the content type of plain text bodies, including the ones of the legacy messages.
+	ContentTypeText = "text/plain"
+	// ContentTypeJSON is the content type of JSON bodies.
+	ContentTypeJSON = "application/json"
 )
 
 // ErrTooManyReq is returned when (mostly) the GCP cloud run instance returns a 429 error.
 var ErrTooManyReq = errors.New("too many requests")
+
+// ErrUnauthorized is returned when Rosenbridge rejects the credentials with a 401 or 403 status code.
+var ErrUnauthorized = errors.New("unauthorized")
+
+// ErrInvalidEndpoint is returned when the Rosenbridge endpoint of the connection params is not usable.
+var ErrInvalidEndpoint = errors.New("invalid endpoint")
+
+// ErrConnectionClosed is returned when an operation is attempted upon a closed connection.
+var ErrConnectionClosed = errors.New("connection closed")
+
+// ErrDuplicateRequestID is returned when a synchronous request is made with the ID of another in-flight request.
+var ErrDuplicateRequestID = errors.New("a request with the same id is already in flight")
+
+// ErrConnectionStale is returned when no frames are received from Rosenbridge within the configured keepalive window.
+var ErrConnectionStale = errors.New("connection stale")
+
+// ErrSendQueueFull is returned when a frame cannot be sent because the outbound queue of the connection is full.
+var ErrSendQueueFull = errors.New("send queue full")
+
+// ErrReceiverOffline indicates that a receiver was offline, and so the message could not be delivered to it.
+var ErrReceiverOffline = errors.New("receiver offline")
+
+// ErrBridgeNotFound indicates that a bridge of the receiver did not exist, and so the message could not be delivered.
+var ErrBridgeNotFound = errors.New("bridge not found")
+
+// ErrDeliveryFailed indicates that the message could not be delivered for an unknown reason.
+var ErrDeliveryFailed = errors.New("delivery failed")
+
+// ErrDecryptionFailed is returned when an encrypted message cannot be decrypted.
+var ErrDecryptionFailed = errors.New("could not decrypt")
+
+// ErrPublicKeyNotFound is returned when a message is to be encrypted for a receiver whose public key is unknown.
+var ErrPublicKeyNotFound = errors.New("public key not found")
+
+// ErrInvalidEnvelope is returned when a message body is marked as an envelope, but cannot be parsed as one.
+var ErrInvalidEnvelope = errors.New("invalid envelope")
@@ -2,17 +2,244 @@ package lib
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
 )
 
 // ConnectionParams are the params required to create the connection.
 type ConnectionParams struct {
 	// ClientID is the ID to which the connection belongs.
 	ClientID string
+	// Endpoint is the base URL of the Rosenbridge deployment, like "https://gw.example.com/rosen/".
+	// Its scheme can be http, https, ws or wss. The websocket and HTTP endpoints are derived from it, so both of them
+	// honour its path prefix and port. Use ParseEndpoint to create it from a string.
+	// If it is nil, the BaseURL and IsTLSEnabled fields are used instead.
+	Endpoint *url.URL
+
 	// BaseURL is the URL of the Rosenbridge deployment without protocol.
+	//
+	// Deprecated: Use Endpoint, which supports path prefixes. BaseURL is only used if Endpoint is nil.
 	BaseURL string
 	// IsTLSEnabled is a flag to tell if the deployment is TLS enabled.
 	// If it is true, connection is attempted with "wss" protocol, otherwise "ws" is used.
+	//
+	// Deprecated: Use Endpoint with the https or wss scheme. IsTLSEnabled is only used if Endpoint is nil.
 	IsTLSEnabled bool
+
+	// PingInterval is the interval at which the connection pings Rosenbridge to keep the bridge alive.
+	// Zero disables the keepalive mechanism altogether.
+	PingInterval time.Duration
+	// PongTimeout is the time for which the connection waits for a pong (or any other frame) beyond the PingInterval.
+	// If nothing is received in that time, the connection is considered stale and is closed with ErrConnectionStale.
+	// It is only used when PingInterval is non-zero. Zero means a default of 10 seconds.
+	PongTimeout time.Duration
+
+	// SendQueueSize is the maximum number of frames that can wait to be written to the connection.
+	// Sending fails with ErrSendQueueFull when the queue is full. Zero means a default of 64.
+	SendQueueSize int
+
+	// Auth, if not nil, adds the credentials to the websocket handshake and to the HTTP requests made to Rosenbridge.
+	// See BearerTokenAuth, APIKeyAuth, BasicAuth and TokenSourceAuth.
+	Auth Authenticator
+
+	// HTTPClient, if not nil, is used for the HTTP requests made to Rosenbridge. Otherwise, NewHTTPClient is used.
+	HTTPClient *http.Client
+	// Dialer, if not nil, is used for establishing the websocket connections. Otherwise, NewDialer is used.
+	Dialer *websocket.Dialer
+
+	// TLSConfig, if not nil, is used for the TLS connections, to set CA bundles, client certificates (mTLS), or the
+	// server name (SNI). It is ignored if both HTTPClient and Dialer are set.
+	TLSConfig *tls.Config
+	// Proxy, if not nil, provides the proxy for every request, like http.ProxyURL does. HTTP, HTTPS and SOCKS5 proxies
+	// are supported. If it is nil, the proxy is taken from the HTTP_PROXY, HTTPS_PROXY and NO_PROXY env vars.
+	// It is ignored if both HTTPClient and Dialer are set.
+	Proxy func(*http.Request) (*url.URL, error)
+	// DialTimeout is the maximum time for establishing a TCP connection and completing the TLS (and websocket)
+	// handshake. Zero means no limit for the HTTP requests, and 45 seconds for the websocket handshake.
+	// It is ignored if both HTTPClient and Dialer are set.
+	DialTimeout time.Duration
+
+	// Retry, if not nil, makes the SendMessage function retry the failed attempts as per the policy.
+	Retry *RetryPolicy
+
+	// Reconnect, if not nil, makes the connection redial Rosenbridge whenever the bridge breaks unexpectedly.
+	// If it is nil, the connection is closed upon the first failure.
+	Reconnect *ReconnectParams
+
+	// Encryption, if not nil, enables the end-to-end encryption of the message bodies.
+	Encryption *EncryptionParams
+	// Signing, if not nil, enables the signing of the outgoing messages, and the verification of the incoming ones.
+	// Messages are signed before they are encrypted, and verified after they are decrypted.
+	Signing *SigningParams
+}
+
+// EncryptionParams control the end-to-end encryption of the message bodies.
+//
+// The bodies are encrypted with NaCl box (X25519, XSalsa20 and Poly1305), so Rosenbridge only relays the ciphertext.
+type EncryptionParams struct {
+	// KeyPair is the key pair of the client. Encrypted incoming messages are decrypted with it, and outgoing messages
+	// are encrypted with it. If it is nil, the encrypted incoming messages fail with ErrDecryptionFailed.
+	KeyPair *KeyPair
+	// Keyring, if not nil, makes all outgoing messages encrypted for the public keys of their receivers, which it must
+	// hold. If it is nil, the outgoing messages are sent as they are.
+	Keyring *Keyring
+}
+
+// KeyPair is the X25519 key pair of a client, used for the end-to-end encryption of the messages.
+type KeyPair struct {
+	// PublicKey is shared with the peers, so they can encrypt messages for the client.
+	PublicKey PublicKey `json:"public_key"`
+	// PrivateKey decrypts the messages encrypted for the client. It must never be shared.
+	PrivateKey PrivateKey `json:"private_key"`
+}
+
+// PublicKey is an X25519 public key. It is encoded as base64 in text and JSON.
+type PublicKey [32]byte
+
+// PrivateKey is an X25519 private key. It is encoded as base64 in JSON.
+type PrivateKey [32]byte
+
+// Keyring holds the public keys of the peers, keyed by their client IDs. It is encoded as a JSON object.
+//
+// The zero value is an empty keyring, ready to use. It is safe for concurrent use, and must not be copied after use.
+type Keyring struct {
+	// keys maps the client IDs to their public keys.
+	keys map[string]PublicKey
+	// mutex guards the keys map.
+	mutex sync.RWMutex
+}
+
+// SigningParams control the Ed25519 signing of the outgoing messages, and the verification of the incoming ones.
+type SigningParams struct {
+	// KeyPair, if not nil, signs all outgoing messages. The signature covers the body, the sender ID, the receiver
+	// IDs and the time of signing.
+	KeyPair *SigningKeyPair
+	// TrustStore, if not nil, verifies all incoming messages against the public keys of their senders, and sets their
+	// Verification field. The signed messages are delivered with the signature removed.
+	TrustStore *TrustStore
+	// DropUnverified makes the connection discard the incoming messages that are not VerificationVerified, instead
+	// of delivering them. It is only used along with the TrustStore.
+	DropUnverified bool
+	// MaxAge is the maximum age of the signature of an incoming message. Messages signed earlier, or later than MaxAge
+	// into the future due to clock skew, are VerificationForged. It limits how long a captured message can be replayed
+	// to its own receiver. Zero means a default of 5 minutes, and a negative value disables the check.
+	MaxAge time.Duration
+}
+
+// SigningKeyPair is the Ed25519 key pair of a client, used for signing the messages it sends.
+type SigningKeyPair struct {
+	// PublicKey is shared with the peers, so they can verify the messages of the client.
+	PublicKey ed25519.PublicKey `json:"public_key"`
+	// PrivateKey signs the messages of the client. It must never be shared.
+	PrivateKey ed25519.PrivateKey `json:"private_key"`
+}
+
+// TrustStore holds the Ed25519 public keys of the trusted peers, keyed by their client IDs. It is encoded as a JSON
+// object of client IDs to base64 public keys.
+//
+// The zero value is an empty trust store, ready to use. It is safe for concurrent use, and must not be copied after
+// use.
+type TrustStore struct {
+	// keys maps the client IDs to their public keys.
+	keys map[string]ed25519.PublicKey
+	// mutex guards the keys map.
+	mutex sync.RWMutex
+}
+
+// Verification tells whether an incoming message is proven to come from its sender, like VerificationVerified.
+type Verification string
+
+// signedMessage is the format of a signed message body, which follows the signedMessagePrefix.
+type signedMessage struct {
+	// Payload is the JSON encoded signedPayload. It is kept raw, so the signature is verified against the exact bytes
+	// that were signed.
+	Payload json.RawMessage `json:"payload"`
+	// Signature is the Ed25519 signature of the Payload.
+	Signature []byte `json:"signature"`
+}
+
+// signedPayload is the content covered by the signature of a signed message.
+type signedPayload struct {
+	// SenderID is the ID of the client who signed the message. It must match the sender of the incoming message.
+	SenderID string `json:"sender_id"`
+	// ReceiverIDs are the intended receivers. A receiver not in the list has been sent a replayed message.
+	ReceiverIDs []string `json:"receiver_ids"`
+	// SignedAt is the time of signing.
+	SignedAt time.Time `json:"signed_at"`
+	// Body is the actual message body.
+	Body string `json:"body"`
+}
+
+// sealedMessage is the format of an encrypted message body, which follows the encryptedMessagePrefix.
+type sealedMessage struct {
+	// SenderKey is the public key of the sender, required by the receivers to open their ContentKeys.
+	SenderKey PublicKey `json:"sender_key"`
+	// ContentKeys map the base64 public key of every receiver to the content key, encrypted for that receiver with
+	// NaCl box. Every sealed content key is prefixed with its nonce.
+	ContentKeys map[string][]byte `json:"content_keys"`
+	// Body is the message body, encrypted with NaCl secretbox using the content key, and prefixed with its nonce.
+	Body []byte `json:"body"`
+}
+
+// ReconnectParams control the automatic reconnection behaviour of a connection.
+//
+// Zero values are replaced with sensible defaults, so an empty ReconnectParams is a valid configuration.
+type ReconnectParams struct {
+	// MaxAttempts is the number of consecutive failed redials after which the connection gives up.
+	// Zero or a negative value means infinite attempts.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first redial attempt.
+	InitialBackoff time.Duration
+	// MaxBackoff is the upper limit of the delay between two redial attempts.
+	MaxBackoff time.Duration
+	// Multiplier is the factor by which the delay grows after every failed attempt.
+	Multiplier float64
+	// Jitter is the fraction (between 0 and 1) of the delay that is randomized to avoid thundering herds.
+	Jitter float64
+}
+
+// RetryPolicy decides if and when a failed operation is retried.
+//
+// Zero values are replaced with sensible defaults, except MaxAttempts, which must be set for any retries to happen.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first one.
+	// A value less than 2 disables retries.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry.
+	InitialBackoff time.Duration
+	// MaxBackoff is the upper limit of the delay between two attempts.
+	MaxBackoff time.Duration
+	// Multiplier is the factor by which the delay grows after every failed attempt.
+	Multiplier float64
+	// Jitter is the fraction (between 0 and 1) of the delay that is randomized to avoid thundering herds.
+	Jitter float64
+	// MaxElapsed is the overall time budget for all attempts. Zero means no limit other than the context.
+	MaxElapsed time.Duration
+
+	// IsRetryable tells if the given error is worth a retry. If it is nil, DefaultIsRetryable is used.
+	IsRetryable func(err error) bool
+	// OnRetry, if not nil, is called before every retry, with the upcoming attempt number, the delay before it, and
+	// the error that caused the retry.
+	OnRetry func(attempt int, delay time.Duration, err error)
+}
+
+// StatusError is returned when Rosenbridge responds with a non-2xx HTTP status code, or rejects a websocket handshake.
+//
+// It matches ErrTooManyReq with errors.Is if the status code is 429, and ErrUnauthorized if it is 401 or 403.
+type StatusError struct {
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+	// Body is the content of the response body.
+	Body string
+	// RetryAfter is the delay requested by the Retry-After header of the response. It is zero if absent.
+	RetryAfter time.Duration
 }
 
 // BridgeMessage is the general schema of all messages that are sent over a bridge.
@@ -25,12 +252,41 @@ type BridgeMessage struct {
 	Body interface{} `json:"body"`
 }
 
+// Envelope is the structured format of a message body, with a content type and metadata along with the body itself.
+//
+// It is carried within the Message field of the requests, so Rosenbridge relays it like any other body. Use
+// NewTextMessage or NewJSONMessage to create one, Encode to put it in a request, and ParseEnvelope (or the Envelope
+// method of IncomingMessageReq) to read it.
+type Envelope struct {
+	// Version is the version of the envelope format. It is zero for the legacy messages, which are plain text bodies
+	// without an envelope.
+	Version int `json:"version"`
+	// ContentType is the MIME type of the body, like ContentTypeText or ContentTypeJSON.
+	ContentType string `json:"content_type,omitempty"`
+	// Headers are arbitrary key-value pairs of metadata.
+	Headers map[string]string `json:"headers,omitempty"`
+	// Timestamp is the time at which the envelope was created.
+	Timestamp time.Time `json:"timestamp"`
+	// MessageID uniquely identifies the message.
+	MessageID string `json:"message_id,omitempty"`
+	// CorrelationID is the MessageID of the message that this one relates to, like the one it replies to.
+	CorrelationID string `json:"correlation_id,omitempty"`
+	// Body is the JSON encoded body. JSON content is embedded as it is, and any other content is a JSON string.
+	Body json.RawMessage `json:"body"`
+}
+
 // IncomingMessageReq is the schema of an incoming message from Rosenbridge.
 type IncomingMessageReq struct {
 	// SenderID is the ID of the client who sent the message.
 	SenderID string `json:"sender_id"`
 	// Message is the main message content.
 	Message string `json:"message"`
+
+	// RequestID is the ID of the request with which the sender sent this message.
+	RequestID string `json:"-"`
+	// Verification tells if the message is proven to come from its sender. It is only set if the connection has a
+	// TrustStore in its signing params.
+	Verification Verification `json:"-"`
 }
 
 // OutgoingMessageReq is the schema of an outgoing message on Rosenbridge.
@@ -53,26 +309,120 @@ type OutgoingMessageRes struct {
 	Code string `json:"code"`
 	// Reason tells why the request is not processable (if it's not).
 	Reason string `json:"reason"`
-	// Report holds the message delivery status for each receiver.
-	Report map[string][]*struct {
-		// ClientID is the ID of the client to whom the bridge belongs.
-		ClientID string `json:"client_id,omitempty"`
-		// BridgeID is the unique ID of the bridge.
-		BridgeID string `json:"bridge_id,omitempty"`
-		// Code tells the final status of message delivery.
-		Code string `json:"code"`
-		// Reason tells why the delivery failed (if it failed).
-		Reason string `json:"reason"`
-	} `json:"report"`
+	// Report holds the message delivery status for each bridge of each receiver, keyed by the receiver IDs.
+	Report map[string][]*DeliveryReport `json:"report"`
 
 	RequestID string `json:"-"`
+	// ReceiverIDs are the receivers of the request, set by SendMessage and Connection.SendMessage. The receivers that
+	// are absent from the Report count as failed. Responses received through the handlers do not have them.
+	ReceiverIDs []string `json:"-"`
+}
+
+// DeliveryReport is the message delivery status for a single bridge of a receiver.
+type DeliveryReport struct {
+	// ClientID is the ID of the client to whom the bridge belongs.
+	ClientID string `json:"client_id,omitempty"`
+	// BridgeID is the unique ID of the bridge.
+	BridgeID string `json:"bridge_id,omitempty"`
+	// Code tells the final status of message delivery.
+	Code DeliveryStatus `json:"code"`
+	// Reason tells why the delivery failed (if it failed).
+	Reason string `json:"reason"`
 }
 
+// DeliveryStatus is the final status of a message delivery, like CodeOK or CodeOffline.
+type DeliveryStatus string
+
+// DeliveryError is the error that describes which receivers did not receive a message, and why.
+//
+// It matches ErrReceiverOffline, ErrBridgeNotFound and ErrDeliveryFailed with errors.Is, depending on the failures.
+type DeliveryError struct {
+	// Failures maps the IDs of the receivers that did not receive the message to their delivery status.
+	Failures map[string]DeliveryStatus
+}
+
+// pendingResponse is the outcome of a synchronous request made over a connection.
+type pendingResponse struct {
+	// response is the response received from Rosenbridge.
+	response *OutgoingMessageRes
+	// err is set if the response could not be received.
+	err error
+}
+
+// outboundFrame is a websocket frame waiting in the outbound queue of a connection.
+type outboundFrame struct {
+	// messageType is the websocket message type of the frame.
+	messageType int
+	// data is the payload of the frame.
+	data []byte
+	// result receives the outcome of the write. It is buffered so the writer never blocks upon it.
+	result chan error
+}
+
+// ConnectionEvent represents a change in the lifecycle of a connection.
+type ConnectionEvent struct {
+	// Type tells what kind of event this is.
+	Type ConnectionEventType
+	// Attempt is the serial number of the redial attempt that this event belongs to.
+	Attempt int
+	// Delay is the time the connection will wait before making the redial attempt.
+	// It is only set for EventReconnecting events.
+	Delay time.Duration
+	// Err is the error that caused the event, if any.
+	Err error
+}
+
+// ConnectionEventType is the type of ConnectionEvent.
+type ConnectionEventType string
+
+// IncomingEvent is an incoming message, or the error that occurred while receiving it.
+// It is delivered through the channel returned by Connection.Messages.
+type IncomingEvent struct {
+	// Message is the received message. It is nil if Err is set.
+	Message *IncomingMessageReq
+	// Err is the error that occurred while receiving/decoding the message.
+	Err error
+}
+
+// ResponseEvent is an outgoing message response, or the error that occurred while receiving it.
+// It is delivered through the channel returned by Connection.Responses.
+type ResponseEvent struct {
+	// Response is the received response. It is nil if Err is set.
+	Response *OutgoingMessageRes
+	// Err is the error that occurred while receiving/decoding the response.
+	Err error
+}
+
+// OverflowPolicy decides what happens when an event is to be delivered to a full channel.
+type OverflowPolicy int
+
+// Authenticator adds the credentials to the headers of the requests made to Rosenbridge.
+// It is called upon every HTTP request and every websocket handshake, including the ones of the reconnections.
+type Authenticator interface {
+	Authenticate(ctx context.Context, header http.Header) error
+}
+
+// AuthenticatorFunc is an adapter to use an ordinary function as an Authenticator.
+type AuthenticatorFunc func(ctx context.Context, header http.Header) error
+
+// TokenSource provides the tokens for authentication, refreshing them as required.
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// TokenSourceFunc is an adapter to use an ordinary function as a TokenSource.
+type TokenSourceFunc func(ctx context.Context) (string, error)
+
 // IncomingMessageHandlerFunc is the type of func that handles incoming messages.
 // The error parameter notifies the caller of any errors that might occur while receiving/decoding the message.
 //
 // Note that if any error occurs before the type of the message itself could be determined, the message will be assumed
 // as an IncomingMessageReq, and so the IncomingMessageHandlerFunc will be invoked.
+//
+// The handler runs on the goroutine that reads from Rosenbridge, so no frames, including pongs and pings, are read
+// until it returns. It does not make the connection stale, but a slow handler delays all other messages, and may make
+// Rosenbridge drop the bridge for not answering its pings. Long work should be moved to another goroutine, for example,
+// one that consumes the Messages channel.
 type IncomingMessageHandlerFunc func(ctx context.Context, message *IncomingMessageReq, err error)
 
 // OutgoingMessageResponseHandlerFunc is the type of func that handles outgoing message responses.
@@ -82,6 +432,9 @@ type IncomingMessageHandlerFunc func(ctx context.Context, message *IncomingMessa
 // as an IncomingMessageReq, and so the IncomingMessageHandlerFunc will be invoked.
 type OutgoingMessageResponseHandlerFunc func(ctx context.Context, response *OutgoingMessageRes, err error)
 
+// ConnectionEventHandlerFunc is the type of func that handles connection lifecycle events.
+type ConnectionEventHandlerFunc func(ctx context.Context, event *ConnectionEvent)
+
 // ConnectionClosureHandlerFunc is the type of func that handles connection closures.
 // The error parameter gives info on why the connection closed.
 type ConnectionClosureHandlerFunc func(ctx context.Context, err interface{})
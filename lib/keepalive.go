@@ -0,0 +1,78 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// startKeepalive starts pinging Rosenbridge over the given low-level connection, so that a dead peer is detected
+// through the read deadline. It returns a func that stops the pinging.
+//
+// Pings from Rosenbridge are always answered through the outbound queue, even if the keepalive mechanism is disabled.
+func (c *Connection) startKeepalive(underlyingConn *websocket.Conn) (stop func()) {
+	// The default ping handler writes directly to the connection, so it is replaced with one that uses the queue.
+	underlyingConn.SetPingHandler(func(appData string) error {
+		c.extendReadDeadline(underlyingConn)
+		// A pong is dropped if the queue is full, the peer will ping again anyway.
+		_, _ = c.queueFrame(websocket.PongMessage, []byte(appData))
+		return nil
+	})
+
+	pingInterval := c.connectionParams.PingInterval
+	if pingInterval <= 0 {
+		return func() {}
+	}
+
+	// The reader arms the read deadline before every read, and the pongs push it further.
+	underlyingConn.SetPongHandler(func(string) error {
+		c.extendReadDeadline(underlyingConn)
+		return nil
+	})
+
+	stopChan := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(pingInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				// Failures are ignored here because a dead peer surfaces through the read deadline anyway.
+				_, _ = c.queueFrame(websocket.PingMessage, nil)
+			case <-stopChan:
+				return
+			}
+		}
+	}()
+
+	return func() { close(stopChan) }
+}
+
+// extendReadDeadline sets the read deadline of the given low-level connection as per the keepalive params.
+// It is a no-op if the keepalive mechanism is disabled.
+func (c *Connection) extendReadDeadline(underlyingConn *websocket.Conn) {
+	pingInterval := c.connectionParams.PingInterval
+	if pingInterval <= 0 {
+		return
+	}
+
+	pongTimeout := c.connectionParams.PongTimeout
+	if pongTimeout <= 0 {
+		pongTimeout = defaultPongTimeout
+	}
+
+	_ = underlyingConn.SetReadDeadline(time.Now().Add(pingInterval + pongTimeout))
+}
+
+// wrapReadError wraps the given read error with ErrConnectionStale if it was caused by the read deadline.
+func wrapReadError(err error) error {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return fmt.Errorf("%w: no frames received in time: %v", ErrConnectionStale, err)
+	}
+	return fmt.Errorf("error in ReadMessage: %w", err)
+}
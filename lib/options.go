@@ -0,0 +1,50 @@
+package lib
+
+// ConnectionOption customizes a connection at construction time.
+//
+// Options are applied before the connection starts reading messages, so unlike assigning the handler fields after
+// NewConnection returns, they cannot miss any messages or race with the reader.
+type ConnectionOption func(conn *Connection)
+
+// WithIncomingMessageHandler sets the handler for incoming messages.
+func WithIncomingMessageHandler(handler IncomingMessageHandlerFunc) ConnectionOption {
+	return func(conn *Connection) { conn.IncomingMessageHandler = handler }
+}
+
+// WithOutgoingMessageResponseHandler sets the handler for outgoing message responses.
+func WithOutgoingMessageResponseHandler(handler OutgoingMessageResponseHandlerFunc) ConnectionOption {
+	return func(conn *Connection) { conn.OutgoingMessageResponseHandler = handler }
+}
+
+// WithConnectionClosureHandler sets the handler for connection closures.
+func WithConnectionClosureHandler(handler ConnectionClosureHandlerFunc) ConnectionOption {
+	return func(conn *Connection) { conn.ConnectionClosureHandler = handler }
+}
+
+// WithConnectionEventHandler sets the handler for connection lifecycle events.
+func WithConnectionEventHandler(handler ConnectionEventHandlerFunc) ConnectionOption {
+	return func(conn *Connection) { conn.ConnectionEventHandler = handler }
+}
+
+// WithMessagesChannel enables the channel returned by Connection.Messages.
+//
+// The bufferSize is the capacity of the channel, and the policy decides what happens when the channel is full.
+// Incoming messages are delivered to the channel in addition to the IncomingMessageHandler.
+func WithMessagesChannel(bufferSize int, policy OverflowPolicy) ConnectionOption {
+	return func(conn *Connection) {
+		conn.messagesChan = make(chan *IncomingEvent, bufferSize)
+		conn.messagesPolicy = policy
+	}
+}
+
+// WithResponsesChannel enables the channel returned by Connection.Responses.
+//
+// The bufferSize is the capacity of the channel, and the policy decides what happens when the channel is full.
+// Outgoing message responses are delivered to the channel in addition to the OutgoingMessageResponseHandler.
+// Responses of the synchronous Connection.SendMessage calls are not delivered to the channel.
+func WithResponsesChannel(bufferSize int, policy OverflowPolicy) ConnectionOption {
+	return func(conn *Connection) {
+		conn.responsesChan = make(chan *ResponseEvent, bufferSize)
+		conn.responsesPolicy = policy
+	}
+}
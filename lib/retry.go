@@ -0,0 +1,82 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Do executes the given operation and retries it as per the policy, until it succeeds, a non-retryable error occurs,
+// the attempts or the time budget are exhausted, or the context expires.
+//
+// It returns the error of the last attempt. A Retry-After duration requested by a *StatusError overrides the backoff.
+func (p *RetryPolicy) Do(ctx context.Context, operation func(ctx context.Context) error) error {
+	isRetryable := p.IsRetryable
+	if isRetryable == nil {
+		isRetryable = DefaultIsRetryable
+	}
+
+	// The overall deadline applies to all attempts together.
+	if p.MaxElapsed > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.MaxElapsed)
+		defer cancel()
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := operation(ctx)
+		if err == nil || attempt >= p.MaxAttempts || !isRetryable(err) {
+			return err
+		}
+
+		delay := p.delay(attempt, err)
+		// Giving up early if the next attempt would start after the deadline anyway.
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+			return err
+		}
+
+		if p.OnRetry != nil {
+			p.OnRetry(attempt+1, delay, err)
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return fmt.Errorf("retries aborted: %w (last error: %v)", ctx.Err(), err)
+		}
+	}
+}
+
+// delay provides the delay before the attempt that follows the given failed attempt.
+func (p *RetryPolicy) delay(failedAttempt int, err error) time.Duration {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+		return statusErr.RetryAfter
+	}
+	return backoffDelay(p.InitialBackoff, p.MaxBackoff, p.Multiplier, p.Jitter, failedAttempt)
+}
+
+// Error implements the error interface.
+func (e *StatusError) Error() string {
+	if e.StatusCode == http.StatusTooManyRequests {
+		return ErrTooManyReq.Error()
+	}
+	if e.Body == "" {
+		return fmt.Sprintf("http request failed with status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("http request failed with status %d: %s", e.StatusCode, e.Body)
+}
+
+// Is makes the error match ErrTooManyReq if the status code is 429.
+func (e *StatusError) Is(target error) bool {
+	switch target {
+	case ErrTooManyReq:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	default:
+		return false
+	}
+}
@@ -0,0 +1,212 @@
+package lib_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shivanshkc/rosenbridge-cli/lib"
+)
+
+func TestRetryPolicy_Do_Attempts(t *testing.T) {
+	testCases := []struct {
+		name        string
+		maxAttempts int
+		err         error
+		expected    int
+	}{
+		{name: "retryable error", maxAttempts: 3, err: &lib.StatusError{StatusCode: 503}, expected: 3},
+		{name: "retries disabled", maxAttempts: 1, err: &lib.StatusError{StatusCode: 503}, expected: 1},
+		{name: "non-retryable error", maxAttempts: 3, err: &lib.StatusError{StatusCode: 400}, expected: 1},
+		{name: "context canceled", maxAttempts: 3, err: context.Canceled, expected: 1},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			var calls int
+			var retries []int
+			policy := &lib.RetryPolicy{
+				MaxAttempts:    testCase.maxAttempts,
+				InitialBackoff: time.Millisecond,
+				OnRetry:        func(attempt int, delay time.Duration, err error) { retries = append(retries, attempt) },
+			}
+
+			err := policy.Do(context.Background(), func(ctx context.Context) error {
+				calls++
+				return testCase.err
+			})
+
+			if !errors.Is(err, testCase.err) {
+				t.Fatalf("expected the error of the last attempt, got: %v", err)
+			}
+			if calls != testCase.expected {
+				t.Fatalf("expected %d attempts, got %d", testCase.expected, calls)
+			}
+			// OnRetry gets the number of the attempt that follows.
+			for i, attempt := range retries {
+				if attempt != i+2 {
+					t.Fatalf("expected retry attempts to start from 2, got: %v", retries)
+				}
+			}
+			if len(retries) != testCase.expected-1 {
+				t.Fatalf("expected %d retries, got %d", testCase.expected-1, len(retries))
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_Do_Success(t *testing.T) {
+	var calls int
+	policy := &lib.RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Millisecond}
+
+	err := policy.Do(context.Background(), func(ctx context.Context) error {
+		calls++
+		if calls < 3 {
+			return &lib.StatusError{StatusCode: http.StatusTooManyRequests}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected success, got: %v", err)
+	}
+	if calls != 3 {
+		t.Fatalf("expected 3 attempts, got %d", calls)
+	}
+}
+
+func TestRetryPolicy_Do_RetryAfter(t *testing.T) {
+	testCases := []struct {
+		name       string
+		retryAfter string
+		min, max   time.Duration
+	}{
+		{name: "seconds", retryAfter: "7200", min: 2 * time.Hour, max: 2 * time.Hour},
+		{
+			// The HTTP dates have a resolution of a second.
+			name: "http date", retryAfter: time.Now().Add(2 * time.Hour).UTC().Format(http.TimeFormat),
+			min: 2*time.Hour - 2*time.Second, max: 2 * time.Hour,
+		},
+		{name: "absent", min: time.Millisecond / 2, max: 2 * time.Millisecond},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+				if testCase.retryAfter != "" {
+					writer.Header().Set("Retry-After", testCase.retryAfter)
+				}
+				writer.WriteHeader(http.StatusServiceUnavailable)
+			}))
+			defer server.Close()
+
+			endpoint, err := lib.ParseEndpoint(server.URL)
+			if err != nil {
+				t.Fatalf("failed to parse endpoint: %v", err)
+			}
+
+			// The retry is aborted as soon as its delay is known.
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			var delay time.Duration
+			params := &lib.ConnectionParams{ClientID: "alice", Endpoint: endpoint, Retry: &lib.RetryPolicy{
+				MaxAttempts:    2,
+				InitialBackoff: time.Millisecond,
+				MaxBackoff:     time.Millisecond,
+				OnRetry: func(attempt int, retryDelay time.Duration, err error) {
+					delay = retryDelay
+					cancel()
+				},
+			}}
+
+			request := &lib.OutgoingMessageReq{Message: "hello", ReceiverIDs: []string{"bob"}}
+			if _, err := lib.SendMessage(ctx, request, params); err == nil {
+				t.Fatal("expected an error, got nil")
+			}
+			if delay < testCase.min || delay > testCase.max {
+				t.Fatalf("expected a delay between %s and %s, got %s", testCase.min, testCase.max, delay)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_Do_MaxElapsed(t *testing.T) {
+	// The attempts go on until the time budget runs out.
+	var calls int
+	policy := &lib.RetryPolicy{
+		MaxAttempts:    1000,
+		InitialBackoff: 5 * time.Millisecond,
+		MaxBackoff:     5 * time.Millisecond,
+		MaxElapsed:     100 * time.Millisecond,
+	}
+
+	start := time.Now()
+	err := policy.Do(context.Background(), func(ctx context.Context) error {
+		calls++
+		return &lib.StatusError{StatusCode: http.StatusServiceUnavailable}
+	})
+
+	var statusErr *lib.StatusError
+	if !errors.As(err, &statusErr) {
+		t.Fatalf("expected the error of the last attempt, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > testTimeout/2 {
+		t.Fatalf("expected the retries to stop after about %s, took %s", policy.MaxElapsed, elapsed)
+	}
+	if calls < 2 || calls >= policy.MaxAttempts {
+		t.Fatalf("expected the time budget to limit the attempts, got %d", calls)
+	}
+
+	// A delay that does not fit in the budget is not waited for at all.
+	calls = 0
+	policy = &lib.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Hour, MaxElapsed: 100 * time.Millisecond}
+	start = time.Now()
+	_ = policy.Do(context.Background(), func(ctx context.Context) error {
+		calls++
+		return &lib.StatusError{StatusCode: http.StatusServiceUnavailable}
+	})
+	if calls != 1 || time.Since(start) > policy.MaxElapsed {
+		t.Fatalf("expected a single attempt without waiting, got %d in %s", calls, time.Since(start))
+	}
+}
+
+func TestRetryPolicy_Do_ContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The context is canceled while waiting for the next attempt.
+	var calls int
+	policy := &lib.RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Hour,
+		OnRetry: func(attempt int, delay time.Duration, err error) {
+			time.AfterFunc(10*time.Millisecond, cancel)
+		},
+	}
+
+	doneChan := make(chan error, 1)
+	go func() {
+		doneChan <- policy.Do(ctx, func(ctx context.Context) error {
+			calls++
+			return &lib.StatusError{StatusCode: http.StatusServiceUnavailable, Body: "cold start"}
+		})
+	}()
+
+	select {
+	case err := <-doneChan:
+		if !errors.Is(err, context.Canceled) || !strings.Contains(err.Error(), "cold start") {
+			t.Fatalf("expected a cancellation with the last error, got: %v", err)
+		}
+		if calls != 1 {
+			t.Fatalf("expected 1 attempt, got %d", calls)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("retries not aborted upon cancellation")
+	}
+}
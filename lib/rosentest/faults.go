@@ -0,0 +1,54 @@
+package rosentest
+
+import (
+	"github.com/google/uuid"
+)
+
+// FailNextRequests makes the server respond to the next n HTTP requests with the given status code, for example,
+// http.StatusTooManyRequests to mimic the cold-start errors of Cloud Run.
+//
+// It applies to the /api/message requests as well as the /api/bridge handshakes.
+func (s *Server) FailNextRequests(n int, statusCode int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i := 0; i < n; i++ {
+		s.failures = append(s.failures, statusCode)
+	}
+}
+
+// DropConnections abruptly closes all bridges of the given client, without any close frames.
+// If the client ID is empty, bridges of all clients are dropped.
+func (s *Server) DropConnections(clientID string) {
+	for _, brdg := range s.getBridges(clientID) {
+		s.removeBridge(brdg)
+	}
+}
+
+// SendMalformedFrame writes the given raw bytes as a text frame to all bridges of the given client.
+// It can be used to test the handling of frames that are not valid bridge messages.
+func (s *Server) SendMalformedFrame(clientID string, frame []byte) {
+	for _, brdg := range s.getBridges(clientID) {
+		_ = brdg.writeRaw(frame)
+	}
+}
+
+// AddGhostBridge registers a bridge for the given client that does not exist anymore.
+// Deliveries to it are reported with the BRIDGE_NOT_FOUND code.
+func (s *Server) AddGhostBridge(clientID string) {
+	s.addBridge(&bridge{id: uuid.NewString(), clientID: clientID})
+}
+
+// popFailure consumes the next injected HTTP failure, if there is one.
+func (s *Server) popFailure() (int, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.failures) == 0 {
+		return 0, false
+	}
+
+	statusCode := s.failures[0]
+	s.failures = s.failures[1:]
+	return statusCode, true
+}
@@ -0,0 +1,9 @@
+package rosentest
+
+// Types of data sent/received over the bridges.
+const (
+	typeIncomingMessageReq string = "INCOMING_MESSAGE_REQ"
+	typeOutgoingMessageReq string = "OUTGOING_MESSAGE_REQ"
+	typeOutgoingMessageRes string = "OUTGOING_MESSAGE_RES"
+	typeErrorRes           string = "ERROR_RES"
+)
@@ -0,0 +1,376 @@
+// Package rosentest provides an in-process fake Rosenbridge server, for testing code that uses the lib package without
+// any network access.
+package rosentest
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	"github.com/shivanshkc/rosenbridge-cli/lib"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// Server is a fake Rosenbridge server.
+//
+// It implements the /api/bridge websocket API and the /api/message HTTP API, routes messages between the connected
+// clients and produces delivery reports like the real server. It also answers the GET /api requests of Client.Ping.
+// Faults can be injected using its methods.
+type Server struct {
+	// URL is the base URL of the server with protocol, for example, http://127.0.0.1:50000.
+	URL string
+
+	// httpServer is the underlying test server.
+	httpServer *httptest.Server
+	// upgrader upgrades the bridge requests to websocket connections.
+	upgrader *websocket.Upgrader
+
+	// bridges maps client IDs to their bridges, which are mapped by their IDs.
+	bridges map[string]map[string]*bridge
+	// routed holds all the messages that have been routed by the server, in order.
+	routed []*lib.OutgoingMessageReq
+	// failures is the queue of injected HTTP failures, consumed one per request.
+	failures []int
+	// authorize, if not nil, decides if a request carries valid credentials.
+	authorize func(header http.Header) bool
+	// mutex guards the bridges, routed, failures and authorize fields.
+	mutex *sync.Mutex
+}
+
+// bridge is a client connection held by the server.
+type bridge struct {
+	// id is the unique ID of the bridge.
+	id string
+	// clientID is the ID of the client who owns the bridge.
+	clientID string
+	// conn is the underlying websocket connection. It is nil for ghost bridges.
+	conn *websocket.Conn
+	// writeMutex serializes the writes to conn, since websocket permits only one concurrent writer.
+	writeMutex *sync.Mutex
+}
+
+// NewServer starts and returns a new fake Rosenbridge server. It should be closed after use.
+func NewServer() *Server {
+	return newServer(false)
+}
+
+// NewTLSServer starts and returns a new fake Rosenbridge server that uses TLS with a self-signed certificate.
+// Its ConnectionParams trust the certificate. It should be closed after use.
+func NewTLSServer() *Server {
+	return newServer(true)
+}
+
+// newServer starts and returns a new fake Rosenbridge server, with or without TLS.
+func newServer(isTLS bool) *Server {
+	server := &Server{
+		upgrader: &websocket.Upgrader{},
+		bridges:  map[string]map[string]*bridge{},
+		mutex:    &sync.Mutex{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api", server.handleIntro)
+	mux.HandleFunc("/api/bridge", server.handleBridge)
+	mux.HandleFunc("/api/message", server.handleMessage)
+
+	server.httpServer = httptest.NewUnstartedServer(server.withFaults(server.withAuth(mux)))
+	if isTLS {
+		server.httpServer.StartTLS()
+	} else {
+		server.httpServer.Start()
+	}
+	server.URL = server.httpServer.URL
+	return server
+}
+
+// Close shuts down the server and abruptly closes all bridges.
+func (s *Server) Close() {
+	s.DropConnections("")
+	s.httpServer.Close()
+}
+
+// ConnectionParams provides the params to connect to this server with the given client ID.
+func (s *Server) ConnectionParams(clientID string) *lib.ConnectionParams {
+	// The URL of an httptest server is always valid.
+	endpoint, _ := lib.ParseEndpoint(s.URL)
+	params := &lib.ConnectionParams{ClientID: clientID, Endpoint: endpoint}
+
+	// Trusting the self-signed certificate of a TLS server.
+	if certificate := s.Certificate(); certificate != nil {
+		pool := x509.NewCertPool()
+		pool.AddCert(certificate)
+		params.TLSConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+	return params
+}
+
+// Certificate provides the certificate of a TLS server. It is nil if the server does not use TLS.
+func (s *Server) Certificate() *x509.Certificate {
+	if s.httpServer.TLS == nil {
+		return nil
+	}
+	return s.httpServer.Certificate()
+}
+
+// BridgeCount provides the number of bridges that the given client has with this server.
+func (s *Server) BridgeCount(clientID string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.bridges[clientID])
+}
+
+// RoutedMessages provides all the messages that have been routed by this server, in order.
+func (s *Server) RoutedMessages() []*lib.OutgoingMessageReq {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]*lib.OutgoingMessageReq(nil), s.routed...)
+}
+
+// RequireAuth makes the server reject the requests and handshakes with a 401 status code, unless the given func
+// approves their headers. A nil func disables the check.
+func (s *Server) RequireAuth(authorize func(header http.Header) bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.authorize = authorize
+}
+
+// RequireBearerToken makes the server accept only the requests and handshakes that carry the given bearer token.
+func (s *Server) RequireBearerToken(token string) {
+	s.RequireAuth(func(header http.Header) bool {
+		return header.Get("Authorization") == "Bearer "+token
+	})
+}
+
+// handleIntro handles the GET /api requests, which are used to check the health of the server.
+func (s *Server) handleIntro(writer http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writer.Header().Set("content-type", "application/json")
+	_ = json.NewEncoder(writer).Encode(map[string]string{"name": "rosenbridge"})
+}
+
+// handleBridge handles the /api/bridge websocket API.
+func (s *Server) handleBridge(writer http.ResponseWriter, req *http.Request) {
+	clientID := req.URL.Query().Get("client_id")
+	if clientID == "" {
+		http.Error(writer, "client_id is required", http.StatusBadRequest)
+		return
+	}
+
+	conn, err := s.upgrader.Upgrade(writer, req, nil)
+	if err != nil {
+		// The upgrader has already responded with the error.
+		return
+	}
+
+	brdg := &bridge{id: uuid.NewString(), clientID: clientID, conn: conn, writeMutex: &sync.Mutex{}}
+	s.addBridge(brdg)
+	defer s.removeBridge(brdg)
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		bridgeMessage := &lib.BridgeMessage{}
+		if err := json.Unmarshal(message, bridgeMessage); err != nil {
+			_ = brdg.write(&lib.BridgeMessage{Type: typeErrorRes, Body: err.Error()})
+			continue
+		}
+
+		// The only type of message that the clients send is an outgoing message request.
+		if bridgeMessage.Type != typeOutgoingMessageReq {
+			_ = brdg.write(&lib.BridgeMessage{Type: typeErrorRes, RequestID: bridgeMessage.RequestID})
+			continue
+		}
+
+		request := &lib.OutgoingMessageReq{}
+		if err := remarshal(bridgeMessage.Body, request); err != nil {
+			_ = brdg.write(&lib.BridgeMessage{Type: typeErrorRes, RequestID: bridgeMessage.RequestID})
+			continue
+		}
+
+		// The sender is always the owner of the bridge, no matter what the request claims.
+		request.SenderID, request.RequestID = clientID, bridgeMessage.RequestID
+		_ = brdg.write(&lib.BridgeMessage{
+			Type:      typeOutgoingMessageRes,
+			RequestID: bridgeMessage.RequestID,
+			Body:      s.route(request),
+		})
+	}
+}
+
+// handleMessage handles the /api/message HTTP API.
+func (s *Server) handleMessage(writer http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	request := &lib.OutgoingMessageReq{}
+	if err := json.NewDecoder(req.Body).Decode(request); err != nil {
+		http.Error(writer, fmt.Sprintf("failed to decode request body: %s", err.Error()), http.StatusBadRequest)
+		return
+	}
+	request.RequestID = req.Header.Get("x-request-id")
+
+	writer.Header().Set("content-type", "application/json")
+	writer.Header().Set("x-request-id", request.RequestID)
+	_ = json.NewEncoder(writer).Encode(s.route(request))
+}
+
+// route delivers the given message to all bridges of all its receivers, and provides the delivery report.
+func (s *Server) route(request *lib.OutgoingMessageReq) *lib.OutgoingMessageRes {
+	if request.SenderID == "" || len(request.ReceiverIDs) == 0 {
+		return &lib.OutgoingMessageRes{Code: string(lib.CodeUnknown), Reason: "sender_id and receiver_ids are required"}
+	}
+
+	s.mutex.Lock()
+	s.routed = append(s.routed, request)
+	s.mutex.Unlock()
+
+	response := &lib.OutgoingMessageRes{Code: string(lib.CodeOK), Report: map[string][]*lib.DeliveryReport{}}
+	incoming := &lib.BridgeMessage{
+		Type:      typeIncomingMessageReq,
+		RequestID: request.RequestID,
+		Body:      &lib.IncomingMessageReq{SenderID: request.SenderID, Message: request.Message},
+	}
+
+	for _, receiverID := range request.ReceiverIDs {
+		bridges := s.getBridges(receiverID)
+		// A receiver without any bridges is offline.
+		if len(bridges) == 0 {
+			response.Report[receiverID] = []*lib.DeliveryReport{
+				{ClientID: receiverID, Code: lib.CodeOffline, Reason: "client is offline"},
+			}
+			continue
+		}
+
+		for _, brdg := range bridges {
+			report := &lib.DeliveryReport{ClientID: receiverID, BridgeID: brdg.id, Code: lib.CodeOK}
+			if err := brdg.write(incoming); err != nil {
+				report.Code, report.Reason = lib.CodeBridgeNotFound, err.Error()
+			}
+			response.Report[receiverID] = append(response.Report[receiverID], report)
+		}
+	}
+
+	return response
+}
+
+// withFaults wraps the given handler, so that the injected HTTP failures are served before the actual handling.
+func (s *Server) withFaults(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		if statusCode, ok := s.popFailure(); ok {
+			http.Error(writer, http.StatusText(statusCode), statusCode)
+			return
+		}
+		handler.ServeHTTP(writer, req)
+	})
+}
+
+// withAuth rejects the unauthorized requests, if the server requires auth.
+func (s *Server) withAuth(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		s.mutex.Lock()
+		authorize := s.authorize
+		s.mutex.Unlock()
+
+		if authorize != nil && !authorize(req.Header) {
+			http.Error(writer, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(writer, req)
+	})
+}
+
+// addBridge registers the given bridge.
+func (s *Server) addBridge(brdg *bridge) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.bridges[brdg.clientID]; !exists {
+		s.bridges[brdg.clientID] = map[string]*bridge{}
+	}
+	s.bridges[brdg.clientID][brdg.id] = brdg
+}
+
+// removeBridge unregisters the given bridge and closes its connection.
+func (s *Server) removeBridge(brdg *bridge) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if brdg.conn != nil {
+		_ = brdg.conn.Close()
+	}
+
+	delete(s.bridges[brdg.clientID], brdg.id)
+	if len(s.bridges[brdg.clientID]) == 0 {
+		delete(s.bridges, brdg.clientID)
+	}
+}
+
+// getBridges provides all bridges of the given client.
+// If the client ID is empty, bridges of all clients are provided.
+func (s *Server) getBridges(clientID string) []*bridge {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var bridges []*bridge
+	for cID, clientBridges := range s.bridges {
+		if clientID != "" && cID != clientID {
+			continue
+		}
+		for _, brdg := range clientBridges {
+			bridges = append(bridges, brdg)
+		}
+	}
+	return bridges
+}
+
+// write writes the given value to the bridge as a JSON text frame.
+func (b *bridge) write(value interface{}) error {
+	message, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+	return b.writeRaw(message)
+}
+
+// writeRaw writes the given bytes to the bridge as a text frame.
+func (b *bridge) writeRaw(message []byte) error {
+	// Ghost bridges have no connection to write to.
+	if b.conn == nil {
+		return fmt.Errorf("bridge %s not found", b.id)
+	}
+
+	b.writeMutex.Lock()
+	defer b.writeMutex.Unlock()
+
+	if err := b.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+		return fmt.Errorf("failed to write to bridge %s: %w", b.id, err)
+	}
+	return nil
+}
+
+// remarshal marshals the given input and unmarshals it into the given output.
+func remarshal(input interface{}, output interface{}) error {
+	inputBytes, err := json.Marshal(input)
+	if err != nil {
+		return fmt.Errorf("error in json.Marshal call: %w", err)
+	}
+	if err := json.Unmarshal(inputBytes, output); err != nil {
+		return fmt.Errorf("error in json.Unmarshal call: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,273 @@
+package rosentest_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/shivanshkc/rosenbridge-cli/lib"
+	"github.com/shivanshkc/rosenbridge-cli/lib/rosentest"
+)
+
+// testTimeout bounds every wait in the tests, so a hang fails the test instead of blocking it forever.
+const testTimeout = 5 * time.Second
+
+func TestServer_Routing(t *testing.T) {
+	server := rosentest.NewServer()
+	defer server.Close()
+
+	// Bob has two bridges, and both of them must receive the message.
+	bobConns := []*lib.Connection{connect(t, server, "bob"), connect(t, server, "bob")}
+	carolConn := connect(t, server, "carol")
+
+	// The sender ID claimed by the request is replaced with the one of the params.
+	request := &lib.OutgoingMessageReq{SenderID: "mallory", Message: "hello", ReceiverIDs: []string{"bob", "carol"}}
+	response, err := lib.SendMessage(context.Background(), request, server.ConnectionParams("alice"))
+	if err != nil {
+		t.Fatalf("failed to send message: %v", err)
+	}
+
+	if len(response.Report["bob"]) != 2 || len(response.Report["carol"]) != 1 {
+		t.Fatalf("expected 2 reports for bob and 1 for carol, got: %+v", response.Report)
+	}
+	if err := response.Err(); err != nil {
+		t.Fatalf("expected the message to be delivered to all receivers, got: %v", err)
+	}
+
+	for _, conn := range append(bobConns, carolConn) {
+		message := receive(t, conn)
+		if message.SenderID != "alice" || message.Message != "hello" {
+			t.Fatalf("unexpected message: %+v", message)
+		}
+	}
+
+	routed := server.RoutedMessages()
+	if len(routed) != 1 || routed[0].SenderID != "alice" {
+		t.Fatalf("expected 1 routed message from alice, got: %+v", routed)
+	}
+}
+
+func TestServer_Routing_OverBridge(t *testing.T) {
+	server := rosentest.NewServer()
+	defer server.Close()
+
+	aliceConn := connect(t, server, "alice")
+	bobConn := connect(t, server, "bob")
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	request := &lib.OutgoingMessageReq{Message: "hello", ReceiverIDs: []string{"bob"}}
+	response, err := aliceConn.SendMessage(ctx, request)
+	if err != nil {
+		t.Fatalf("failed to send message: %v", err)
+	}
+	if response.ReceiverStatus("bob") != lib.CodeOK {
+		t.Fatalf("expected OK for bob, got: %s", response.ReceiverStatus("bob"))
+	}
+
+	// The request ID of the sender is carried to the receiver.
+	message := receive(t, bobConn)
+	if message.SenderID != "alice" || message.RequestID != request.RequestID {
+		t.Fatalf("unexpected message: %+v", message)
+	}
+}
+
+func TestServer_Reports(t *testing.T) {
+	server := rosentest.NewServer()
+	defer server.Close()
+
+	// Carol has only a ghost bridge, while dave has a ghost bridge besides a live one.
+	server.AddGhostBridge("carol")
+	server.AddGhostBridge("dave")
+	connect(t, server, "dave")
+
+	request := &lib.OutgoingMessageReq{Message: "hello", ReceiverIDs: []string{"bob", "carol", "dave"}}
+	response, err := lib.SendMessage(context.Background(), request, server.ConnectionParams("alice"))
+	if err != nil {
+		t.Fatalf("failed to send message: %v", err)
+	}
+
+	expected := map[string]lib.DeliveryStatus{
+		"bob":   lib.CodeOffline,
+		"carol": lib.CodeBridgeNotFound,
+		"dave":  lib.CodeOK,
+	}
+	for receiverID, status := range expected {
+		if actual := response.ReceiverStatus(receiverID); actual != status {
+			t.Fatalf("expected %s for %s, got: %s", status, receiverID, actual)
+		}
+	}
+
+	err = response.Err()
+	if !errors.Is(err, lib.ErrReceiverOffline) || !errors.Is(err, lib.ErrBridgeNotFound) {
+		t.Fatalf("expected the error to match ErrReceiverOffline and ErrBridgeNotFound, got: %v", err)
+	}
+}
+
+func TestServer_FailNextRequests(t *testing.T) {
+	server := rosentest.NewServer()
+	defer server.Close()
+
+	params := server.ConnectionParams("alice")
+	request := &lib.OutgoingMessageReq{Message: "hello", ReceiverIDs: []string{"bob"}}
+
+	// Only the given number of requests fail.
+	server.FailNextRequests(2, http.StatusServiceUnavailable)
+	for i := 0; i < 2; i++ {
+		var statusErr *lib.StatusError
+		_, err := lib.SendMessage(context.Background(), request, params)
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusServiceUnavailable {
+			t.Fatalf("expected a StatusError with status 503, got: %v", err)
+		}
+	}
+	if _, err := lib.SendMessage(context.Background(), request, params); err != nil {
+		t.Fatalf("expected the request to succeed, got: %v", err)
+	}
+
+	// The handshakes fail too.
+	server.FailNextRequests(1, http.StatusTooManyRequests)
+	if _, err := lib.NewConnection(context.Background(), params); !errors.Is(err, lib.ErrTooManyReq) {
+		t.Fatalf("expected ErrTooManyReq, got: %v", err)
+	}
+
+	// The retry policy gets past the failures.
+	server.FailNextRequests(2, http.StatusTooManyRequests)
+	params.Retry = &lib.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+	if _, err := lib.SendMessage(context.Background(), request, params); err != nil {
+		t.Fatalf("expected the retries to succeed, got: %v", err)
+	}
+}
+
+func TestServer_DropConnections(t *testing.T) {
+	server := rosentest.NewServer()
+	defer server.Close()
+
+	bobConn := connect(t, server, "bob")
+	server.DropConnections("bob")
+
+	select {
+	case <-bobConn.Done():
+	case <-time.After(testTimeout):
+		t.Fatal("connection not closed after the drop")
+	}
+	if bobConn.Err() == nil {
+		t.Fatal("expected a closure error, got nil")
+	}
+	if count := server.BridgeCount("bob"); count != 0 {
+		t.Fatalf("expected no bridges of bob, got: %d", count)
+	}
+
+	// A reconnecting connection comes back by itself.
+	params := server.ConnectionParams("carol")
+	params.Reconnect = &lib.ReconnectParams{InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	reconnected := make(chan struct{}, 1)
+	connectWithParams(t, server, params,
+		lib.WithConnectionEventHandler(func(ctx context.Context, event *lib.ConnectionEvent) {
+			if event.Type == lib.EventReconnected {
+				reconnected <- struct{}{}
+			}
+		}),
+	)
+
+	server.DropConnections("carol")
+	select {
+	case <-reconnected:
+	case <-time.After(testTimeout):
+		t.Fatal("connection not re-established after the drop")
+	}
+	waitForBridge(t, server, "carol")
+}
+
+func TestServer_SendMalformedFrame(t *testing.T) {
+	server := rosentest.NewServer()
+	defer server.Close()
+
+	bobConn := connect(t, server, "bob")
+	server.SendMalformedFrame("bob", []byte("{not json"))
+
+	select {
+	case event := <-bobConn.Messages():
+		if event.Err == nil {
+			t.Fatalf("expected a decoding error, got: %+v", event.Message)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("malformed frame not reported")
+	}
+
+	// The connection survives the malformed frame.
+	request := &lib.OutgoingMessageReq{Message: "hello", ReceiverIDs: []string{"bob"}}
+	if _, err := lib.SendMessage(context.Background(), request, server.ConnectionParams("alice")); err != nil {
+		t.Fatalf("failed to send message: %v", err)
+	}
+	if message := receive(t, bobConn); message.Message != "hello" {
+		t.Fatalf("unexpected message: %+v", message)
+	}
+}
+
+// connect creates a connection for the given client with the messages channel enabled, and waits until the server
+// registers its bridge. The connection is closed when the test ends.
+func connect(t *testing.T, server *rosentest.Server, clientID string) *lib.Connection {
+	t.Helper()
+
+	//nolint:gomnd // Enough room for the messages of a test.
+	return connectWithParams(t, server, server.ConnectionParams(clientID),
+		lib.WithMessagesChannel(16, lib.OverflowDropNewest))
+}
+
+// connectWithParams creates a connection with the given params, and waits until the server registers its bridge.
+// The connection is closed when the test ends.
+func connectWithParams(t *testing.T, server *rosentest.Server, params *lib.ConnectionParams,
+	opts ...lib.ConnectionOption,
+) *lib.Connection {
+	t.Helper()
+
+	before := server.BridgeCount(params.ClientID)
+	opts = append(opts, lib.WithConnectionClosureHandler(func(ctx context.Context, err interface{}) {}))
+
+	conn, err := lib.NewConnection(context.Background(), params, opts...)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	deadline := time.Now().Add(testTimeout)
+	for server.BridgeCount(params.ClientID) == before {
+		if time.Now().After(deadline) {
+			t.Fatalf("bridge of %s not registered", params.ClientID)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return conn
+}
+
+// waitForBridge waits until the server has a bridge of the given client.
+func waitForBridge(t *testing.T, server *rosentest.Server, clientID string) {
+	t.Helper()
+
+	deadline := time.Now().Add(testTimeout)
+	for server.BridgeCount(clientID) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("bridge of %s not registered", clientID)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// receive waits for the next message of the given connection, which must have the messages channel enabled.
+func receive(t *testing.T, conn *lib.Connection) *lib.IncomingMessageReq {
+	t.Helper()
+
+	select {
+	case event := <-conn.Messages():
+		if event.Err != nil {
+			t.Fatalf("failed to receive message: %v", event.Err)
+		}
+		return event.Message
+	case <-time.After(testTimeout):
+		t.Fatal("message not received")
+		return nil
+	}
+}
@@ -0,0 +1,211 @@
+package lib
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// GenerateSigningKeyPair generates a new random Ed25519 key pair for signing the messages.
+func GenerateSigningKeyPair() (*SigningKeyPair, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key pair: %w", err)
+	}
+	return &SigningKeyPair{PublicKey: publicKey, PrivateKey: privateKey}, nil
+}
+
+// ParseSigningPublicKey parses a base64 encoded Ed25519 public key.
+func ParseSigningPublicKey(encoded string) (ed25519.PublicKey, error) {
+	key := make([]byte, ed25519.PublicKeySize)
+	if err := decodeKey([]byte(encoded), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Add adds the public key of the given client to the trust store, replacing its existing key, if any.
+func (t *TrustStore) Add(clientID string, key ed25519.PublicKey) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.keys == nil {
+		t.keys = map[string]ed25519.PublicKey{}
+	}
+	t.keys[clientID] = key
+}
+
+// Get provides the public key of the given client. The boolean is false if the trust store does not hold it.
+func (t *TrustStore) Get(clientID string) (ed25519.PublicKey, bool) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	key, exists := t.keys[clientID]
+	return key, exists
+}
+
+// Remove removes the public key of the given client. It returns false if the trust store did not hold it.
+func (t *TrustStore) Remove(clientID string) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	_, exists := t.keys[clientID]
+	delete(t.keys, clientID)
+	return exists
+}
+
+// ClientIDs provides the IDs of all clients in the trust store, in sorted order.
+func (t *TrustStore) ClientIDs() []string {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	clientIDs := make([]string, 0, len(t.keys))
+	for clientID := range t.keys {
+		clientIDs = append(clientIDs, clientID)
+	}
+	sort.Strings(clientIDs)
+	return clientIDs
+}
+
+// MarshalJSON encodes the trust store as a JSON object of client IDs to base64 public keys.
+func (t *TrustStore) MarshalJSON() ([]byte, error) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	keys := t.keys
+	// An empty trust store is encoded as an empty object, rather than null.
+	if keys == nil {
+		keys = map[string]ed25519.PublicKey{}
+	}
+	return json.Marshal(keys)
+}
+
+// UnmarshalJSON decodes a trust store encoded by MarshalJSON, replacing all of its keys.
+func (t *TrustStore) UnmarshalJSON(data []byte) error {
+	keys := map[string]ed25519.PublicKey{}
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return err
+	}
+	for clientID, key := range keys {
+		if len(key) != ed25519.PublicKeySize {
+			return fmt.Errorf("invalid key size of %s: expected %d bytes, got %d", clientID, ed25519.PublicKeySize,
+				len(key))
+		}
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.keys = keys
+	return nil
+}
+
+// IsSigned tells if the given message body is signed by its sender.
+func IsSigned(message string) bool {
+	return strings.HasPrefix(message, signedMessagePrefix)
+}
+
+// SignMessage signs the given message body on behalf of the given sender, for the given receivers.
+func SignMessage(message string, keyPair *SigningKeyPair, senderID string, receiverIDs []string) (string, error) {
+	payload, err := json.Marshal(&signedPayload{
+		SenderID:    senderID,
+		ReceiverIDs: receiverIDs,
+		SignedAt:    time.Now().UTC(),
+		Body:        message,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal signed payload: %w", err)
+	}
+
+	signedBytes, err := json.Marshal(&signedMessage{
+		Payload:   payload,
+		Signature: ed25519.Sign(keyPair.PrivateKey, payload),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal signed message: %w", err)
+	}
+	return signedMessagePrefix + string(signedBytes), nil
+}
+
+// VerifyMessage verifies the given incoming message in place, for the given receiver, using the given trust store.
+//
+// It sets the Verification field of the message. If the message is signed, its body is replaced with the signed body,
+// even if the verification fails.
+// If maxAge is positive, the messages signed more than maxAge ago, or more than maxAge in the future, are forged. This
+// shortens the time for which a captured message can be replayed to the same receiver, but does not rule it out.
+func VerifyMessage(message *IncomingMessageReq, receiverID string, trustStore *TrustStore,
+	maxAge time.Duration,
+) {
+	if !IsSigned(message.Message) {
+		message.Verification = VerificationUnverified
+		return
+	}
+
+	signed := &signedMessage{}
+	payload := &signedPayload{}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(message.Message, signedMessagePrefix)), signed); err != nil {
+		message.Verification = VerificationForged
+		return
+	}
+	if err := json.Unmarshal(signed.Payload, payload); err != nil {
+		message.Verification = VerificationForged
+		return
+	}
+	message.Message = payload.Body
+
+	key, exists := trustStore.Get(message.SenderID)
+	switch {
+	case !exists:
+		message.Verification = VerificationUnverified
+	case !ed25519.Verify(key, signed.Payload, signed.Signature):
+		message.Verification = VerificationForged
+	// A valid signature made for another sender or receiver means that the message was captured and resent.
+	case payload.SenderID != message.SenderID || !containsString(payload.ReceiverIDs, receiverID):
+		message.Verification = VerificationForged
+	// A captured message can also be resent to its own receiver, so only the recent signatures are accepted.
+	case maxAge > 0 && !isRecent(payload.SignedAt, maxAge):
+		message.Verification = VerificationForged
+	default:
+		message.Verification = VerificationVerified
+	}
+}
+
+// signRequest provides a copy of the given request, with its message signed on behalf of the given sender as per the
+// signing params. The request is returned as it is if the params do not require signing.
+func signRequest(request *OutgoingMessageReq, senderID string, params *SigningParams) (*OutgoingMessageReq, error) {
+	if params == nil || params.KeyPair == nil {
+		return request, nil
+	}
+	if len(params.KeyPair.PrivateKey) != ed25519.PrivateKeySize {
+		return nil, errors.New("failed to sign message: invalid signing key pair")
+	}
+
+	signed, err := SignMessage(request.Message, params.KeyPair, senderID, request.ReceiverIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	requestCopy := *request
+	requestCopy.Message = signed
+	return &requestCopy, nil
+}
+
+// isRecent tells if the given time is within maxAge of the current time, in either direction.
+func isRecent(t time.Time, maxAge time.Duration) bool {
+	age := time.Since(t)
+	return age <= maxAge && age >= -maxAge
+}
+
+// containsString tells if the given slice contains the given string.
+func containsString(slice []string, value string) bool {
+	for _, element := range slice {
+		if element == value {
+			return true
+		}
+	}
+	return false
+}
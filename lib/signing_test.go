@@ -0,0 +1,102 @@
+package lib_test
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/shivanshkc/rosenbridge-cli/lib"
+)
+
+func TestVerifyMessage(t *testing.T) {
+	keyPair, err := lib.GenerateSigningKeyPair()
+	if err != nil {
+		t.Fatalf("failed to generate key pair: %v", err)
+	}
+	trustStore := &lib.TrustStore{}
+	trustStore.Add("alice", keyPair.PublicKey)
+
+	fresh, err := lib.SignMessage("hello", keyPair, "alice", []string{"bob"})
+	if err != nil {
+		t.Fatalf("failed to sign message: %v", err)
+	}
+
+	testCases := []struct {
+		name       string
+		message    string
+		senderID   string
+		receiverID string
+		maxAge     time.Duration
+		expected   lib.Verification
+	}{
+		{
+			name: "fresh signature", message: fresh, senderID: "alice", receiverID: "bob", maxAge: time.Minute,
+			expected: lib.VerificationVerified,
+		},
+		{
+			name: "not signed", message: "hello", senderID: "alice", receiverID: "bob", maxAge: time.Minute,
+			expected: lib.VerificationUnverified,
+		},
+		{
+			name: "replayed to another receiver", message: fresh, senderID: "alice", receiverID: "carol",
+			maxAge: time.Minute, expected: lib.VerificationForged,
+		},
+		{
+			name:     "replayed to the same receiver later",
+			message:  signAt(t, keyPair, "alice", []string{"bob"}, time.Now().Add(-time.Hour)),
+			senderID: "alice", receiverID: "bob", maxAge: time.Minute, expected: lib.VerificationForged,
+		},
+		{
+			name:     "signed in the future",
+			message:  signAt(t, keyPair, "alice", []string{"bob"}, time.Now().Add(time.Hour)),
+			senderID: "alice", receiverID: "bob", maxAge: time.Minute, expected: lib.VerificationForged,
+		},
+		{
+			name:     "age check disabled",
+			message:  signAt(t, keyPair, "alice", []string{"bob"}, time.Now().Add(-time.Hour)),
+			senderID: "alice", receiverID: "bob", expected: lib.VerificationVerified,
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			message := &lib.IncomingMessageReq{SenderID: testCase.senderID, Message: testCase.message}
+			lib.VerifyMessage(message, testCase.receiverID, trustStore, testCase.maxAge)
+
+			if message.Verification != testCase.expected {
+				t.Fatalf("expected %s, got %s", testCase.expected, message.Verification)
+			}
+			if message.Message != "hello" {
+				t.Fatalf("expected the signed body, got %q", message.Message)
+			}
+		})
+	}
+}
+
+// signAt signs the "hello" body like SignMessage does, but with the given time of signing.
+func signAt(t *testing.T, keyPair *lib.SigningKeyPair, senderID string, receiverIDs []string,
+	signedAt time.Time,
+) string {
+	t.Helper()
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"sender_id":    senderID,
+		"receiver_ids": receiverIDs,
+		"signed_at":    signedAt.UTC(),
+		"body":         "hello",
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal payload: %v", err)
+	}
+
+	signed, err := json.Marshal(map[string]interface{}{
+		"payload":   json.RawMessage(payload),
+		"signature": ed25519.Sign(keyPair.PrivateKey, payload),
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal signed message: %v", err)
+	}
+	return "rosen-sig.v1:" + string(signed)
+}
@@ -0,0 +1,80 @@
+package lib
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// dialKeepAlive is the keepalive period of the TCP connections made by the derived transports.
+const dialKeepAlive = 30 * time.Second
+
+// NewHTTPClient provides the HTTP client that SendMessage uses when the HTTPClient of the params is nil.
+//
+// It honours the TLSConfig, Proxy and DialTimeout params. Since a new transport is created upon every call, callers
+// that send many messages should create the client once and set it as the HTTPClient, so the connections are reused.
+func NewHTTPClient(params *ConnectionParams) *http.Client {
+	// The default client shares the default transport, so its connections are reused anyway.
+	if params.TLSConfig == nil && params.Proxy == nil && params.DialTimeout <= 0 {
+		return http.DefaultClient
+	}
+
+	return &http.Client{Transport: newTransport(params)}
+}
+
+// newTransport provides a new HTTP transport, modified as per the TLSConfig, Proxy and DialTimeout params.
+// It is a clone of http.DefaultTransport, so it shares neither the connections nor the state of the default one.
+func newTransport(params *ConnectionParams) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone() //nolint:forcetypeassert // It is always a Transport.
+	if params.TLSConfig != nil {
+		transport.TLSClientConfig = params.TLSConfig.Clone()
+	}
+	if params.Proxy != nil {
+		transport.Proxy = params.Proxy
+	}
+	if params.DialTimeout > 0 {
+		dialer := &net.Dialer{Timeout: params.DialTimeout, KeepAlive: dialKeepAlive}
+		transport.DialContext = dialer.DialContext
+		transport.TLSHandshakeTimeout = params.DialTimeout
+	}
+	return transport
+}
+
+// NewDialer provides the websocket dialer that NewConnection uses when the Dialer of the params is nil.
+//
+// It is a copy of websocket.DefaultDialer, modified as per the TLSConfig, Proxy and DialTimeout params.
+func NewDialer(params *ConnectionParams) *websocket.Dialer {
+	dialer := *websocket.DefaultDialer
+
+	if params.TLSConfig != nil {
+		dialer.TLSClientConfig = params.TLSConfig.Clone()
+	}
+	if params.Proxy != nil {
+		dialer.Proxy = params.Proxy
+	}
+	if params.DialTimeout > 0 {
+		netDialer := &net.Dialer{Timeout: params.DialTimeout, KeepAlive: dialKeepAlive}
+		dialer.NetDialContext = netDialer.DialContext
+		dialer.HandshakeTimeout = params.DialTimeout
+	}
+
+	return &dialer
+}
+
+// getHTTPClient provides the HTTP client to use as per the connection params.
+func getHTTPClient(params *ConnectionParams) *http.Client {
+	if params.HTTPClient != nil {
+		return params.HTTPClient
+	}
+	return NewHTTPClient(params)
+}
+
+// getDialer provides the websocket dialer to use as per the connection params.
+func getDialer(params *ConnectionParams) *websocket.Dialer {
+	if params.Dialer != nil {
+		return params.Dialer
+	}
+	return NewDialer(params)
+}
@@ -0,0 +1,91 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// websocketMessageWriter is the only routine that writes to the underlying connection.
+// It serializes all frames (messages, pings, pongs and close frames), since websocket permits only one concurrent writer.
+func websocketMessageWriter(conn *Connection) {
+	defer close(conn.writerDoneChan)
+
+	for {
+		select {
+		case frame := <-conn.outboundQueue:
+			// The result channel is buffered, so this never blocks.
+			frame.result <- conn.writeFrame(frame)
+		case <-conn.doneChan:
+			return
+		}
+	}
+}
+
+// writeFrame writes the given frame to the current underlying connection.
+func (c *Connection) writeFrame(frame *outboundFrame) error {
+	underlyingConn := c.getUnderlyingConn()
+	deadline := time.Now().Add(writeTimeout)
+
+	switch frame.messageType {
+	case websocket.CloseMessage, websocket.PingMessage, websocket.PongMessage:
+		if err := underlyingConn.WriteControl(frame.messageType, frame.data, deadline); err != nil {
+			return fmt.Errorf("error in WriteControl: %w", err)
+		}
+	default:
+		_ = underlyingConn.SetWriteDeadline(deadline)
+		if err := underlyingConn.WriteMessage(frame.messageType, frame.data); err != nil {
+			return fmt.Errorf("error in WriteMessage: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// queueFrame puts the given frame in the outbound queue without blocking.
+// It returns ErrSendQueueFull if the queue has no room, so the callers get backpressure instead of unbounded growth.
+func (c *Connection) queueFrame(messageType int, data []byte) (*outboundFrame, error) {
+	frame := &outboundFrame{messageType: messageType, data: data, result: make(chan error, 1)}
+
+	select {
+	case <-c.writerDoneChan:
+		return nil, ErrConnectionClosed
+	default:
+	}
+
+	select {
+	case c.outboundQueue <- frame:
+		return frame, nil
+	default:
+		return nil, ErrSendQueueFull
+	}
+}
+
+// awaitFrame waits until the given queued frame is written, and returns the outcome of the write.
+func (c *Connection) awaitFrame(ctx context.Context, frame *outboundFrame) error {
+	select {
+	case err := <-frame.result:
+		return err
+	case <-c.writerDoneChan:
+		// The frame may have been written just before the writer exited.
+		select {
+		case err := <-frame.result:
+			return err
+		default:
+			return ErrConnectionClosed
+		}
+	case <-ctx.Done():
+		return fmt.Errorf("frame not written: %w", ctx.Err())
+	}
+}
+
+// sendFrame queues the given frame and waits until it is written.
+func (c *Connection) sendFrame(ctx context.Context, messageType int, data []byte) error {
+	frame, err := c.queueFrame(messageType, data)
+	if err != nil {
+		return err
+	}
+	return c.awaitFrame(ctx, frame)
+}